@@ -4,6 +4,7 @@ set -e
 # Create target directories.
 mkdir -p web/
 mkdir -p bin/
+mkdir -p data/
 
 # Build the Go binary.
 
@@ -19,6 +20,9 @@ if [ $# -eq 0 ]
 fi
 cd ..
 
+# Copy the game data.
+cp server/data/* data/
+
 # Build the elm outputs.
 cd js; elm-make Main.elm --yes --output=../web/elm.js; cd ..
 
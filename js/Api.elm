@@ -2,11 +2,14 @@ module Api
     exposing
         ( Action(..)
         , ServerAction(..)
+        , Offer
+        , Inventory
         , decodeMessage
         , encodeToMessage
         )
 
 import BaseType exposing (..)
+import Card exposing (Card)
 import Material exposing (Fruit, Material)
 import Json.Decode as D
 import Json.Encode as E
@@ -16,7 +19,7 @@ type Action
     = Welcome String
     | GameStateChanged StageType
     | SetClock Int
-    | Auction CardSeed
+    | Auction Card
     | BidUpdated Int String
     | AuctionWon
     | PriceUpdated Price
@@ -24,7 +27,8 @@ type Action
         { yieldRateModifier : Material Float
         }
     | SaleCompleted Int Fruit Float
-    | TradeCompleted (Material Int)
+    | TradeCompleted Offer
+    | InventoryUpdated Inventory
     | GameOver String
     | PlayerInfoUpdated (List PlayerInfo)
 
@@ -84,9 +88,9 @@ actionHelp a =
                     )
                 )
 
-        "auction_seed" ->
+        "auction_card" ->
             D.map Auction <|
-                D.field "seed" D.int
+                D.field "card" card
 
         "bid_updated" ->
             D.map2 BidUpdated
@@ -107,26 +111,19 @@ actionHelp a =
 
         "sale_completed" ->
             D.map3 SaleCompleted
-                (D.field "quantiy" D.int)
+                (D.field "quantity" D.int)
                 (D.field "type" fruit)
                 (D.field "price" D.float)
 
         "trade_completed" ->
-            D.map TradeCompleted <|
-                D.field "materials"
-                    (D.string
-                        |> D.andThen
-                            (D.decodeString (material D.int)
-                                >> (\r ->
-                                        case r of
-                                            Ok mat ->
-                                                D.succeed mat
-
-                                            Err e ->
-                                                D.fail e
-                                   )
-                            )
-                    )
+            D.map TradeCompleted offer
+
+        "inventory_updated" ->
+            D.map InventoryUpdated <|
+                D.map3 Inventory
+                    (optionalField "money" D.float 0)
+                    (optionalField "materials" (partialMaterial D.int 0) Material.empty)
+                    (optionalField "factories" (partialMaterial D.int 0) Material.empty)
 
         "game_over" ->
             D.map GameOver <|
@@ -150,6 +147,68 @@ fruit =
             )
 
 
+card : D.Decoder Card
+card =
+    let
+        base =
+            Card.baseCard
+    in
+        D.map5
+            (\name description cost yieldRateModifier priceModifier ->
+                { base
+                    | name = name
+                    , description = description
+                    , startingBid = cost
+                    , yieldRateModifier = yieldRateModifier
+                    , priceModifier = priceModifier
+                }
+            )
+            (D.field "name" D.string)
+            (optionalField "description" D.string "")
+            (optionalField "cost" D.int 0)
+            (optionalField "yield_rate_modifier" modifier Card.noModifier)
+            (optionalField "price_modifier" modifier Card.noModifier)
+
+
+{-| Decodes a map of modifiers, in which fruits that aren't mentioned are
+left unmodified.
+-}
+modifier : D.Decoder (Material Float)
+modifier =
+    D.oneOf
+        [ D.null Card.noModifier
+        , partialMaterial D.float 1
+        ]
+
+
+{-| Decodes a map of fruits, in which fruits that aren't mentioned take the
+default value.
+-}
+partialMaterial : D.Decoder a -> a -> D.Decoder (Material a)
+partialMaterial a default =
+    let
+        field name =
+            optionalField name a default
+    in
+        D.map4 Material
+            (field "blueberry")
+            (field "tomato")
+            (field "corn")
+            (field "purple")
+
+
+optionalField : String -> D.Decoder a -> a -> D.Decoder a
+optionalField name a default =
+    D.map (Maybe.withDefault default) (D.maybe (D.field name a))
+
+
+offer : D.Decoder Offer
+offer =
+    D.map2 Offer
+        (optionalField "materials" (partialMaterial D.int 0) Material.empty)
+        (optionalField "money" D.float 0)
+
+
 price : D.Decoder Price
 price =
     material D.float
@@ -164,13 +223,31 @@ material a =
         (D.field "purple" a)
 
 
+{-| The goods that change hands in a trade.
+-}
+type alias Offer =
+    { materials : Material Int
+    , money : Float
+    }
+
+
+{-| What the server's ledger says that the player holds.
+-}
+type alias Inventory =
+    { money : Float
+    , materials : Material Int
+    , factories : Material Int
+    }
+
+
 type ServerAction
     = JoinGame String
     | Ready Bool
     | Bid Int
     | SetName String
     | Sell Fruit Int
-    | Trade (Material Int)
+    | Plant Fruit
+    | Trade Offer
     | ActivateCard CardSeed
     | ApplyEffect
         { yieldRateModifier : Material Float
@@ -216,12 +293,16 @@ encodeServerAction a =
                       ]
                     )
 
-                Trade mat ->
+                Plant type_ ->
+                    ( "plant"
+                    , [ ( "type", encodeFruit type_ )
+                      ]
+                    )
+
+                Trade { materials, money } ->
                     ( "trade"
-                    , [ ( "materials"
-                        , E.string
-                            (E.encode 0 (encodeMaterial E.int mat))
-                        )
+                    , [ ( "materials", encodeMaterial E.int materials )
+                      , ( "money", E.float money )
                       ]
                     )
 
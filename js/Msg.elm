@@ -40,12 +40,10 @@ type ReadyMsg
 
 
 type TradeMsg
-    = Yield
-    | MoveToBasket Fruit Int
+    = MoveToBasket Fruit Int
     | SellButton Fruit
     | EmptyBasket
     | Shake
-    | YieldRoll (Material Int)
 
 
 type ProductionMsg
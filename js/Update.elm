@@ -14,7 +14,6 @@ import Helper
 import ZoomList
 import AnimationFrame
 import Time exposing (Time)
-import Random
 import Debug
 
 
@@ -45,20 +44,12 @@ subscriptions model =
                         Sub.none
                 , case m.stage of
                     TradeStage _ ->
-                        Sub.batch
-                            [ Shake.shake
-                                (AppMsg
-                                    << GameMsg
-                                    << TradeMsg
-                                    << always Shake
-                                )
-                            , Time.every Time.second
-                                (AppMsg
-                                    << GameMsg
-                                    << TradeMsg
-                                    << always Yield
-                                )
-                            ]
+                        Shake.shake
+                            (AppMsg
+                                << GameMsg
+                                << TradeMsg
+                                << always Shake
+                            )
 
                     _ ->
                         Sub.none
@@ -162,7 +153,14 @@ updateGame { toServer, toMsg } msg model =
                             ! [ toGameServer (Api.SetName name) ]
 
             ProductionMsg msg ->
-                tryUpdate production (updateProduction msg) model
+                tryUpdate production
+                    (updateProduction
+                        { toGameServer = toGameServer
+                        , toMsg = toMsg << ProductionMsg
+                        }
+                        msg
+                    )
+                    model
 
             AuctionMsg msg ->
                 tryUpdate auction
@@ -207,11 +205,11 @@ updateGame { toServer, toMsg } msg model =
                 { model | cards = ZoomList.unzoom model.cards } ! []
 
 
-updateProduction : ProductionMsg -> Upd ProductionModel
-updateProduction msg model =
+updateProduction : GameCtx ProductionMsg -> ProductionMsg -> Upd ProductionModel
+updateProduction { toGameServer } msg model =
     case msg of
         FactorySelected fr ->
-            { model | selected = Just fr } ! []
+            { model | selected = Just fr } ! [ toGameServer (Api.Plant fr) ]
 
 
 updateAuction : GameCtx AuctionMsg -> AuctionMsg -> Upd AuctionModel
@@ -240,69 +238,6 @@ updateAuction { toGameServer } msg model =
 handleTradeMsg : GameCtx TradeMsg -> TradeMsg -> Upd GameModel
 handleTradeMsg { toGameServer, toMsg } msg model =
     case msg of
-        Yield ->
-            let
-                roundAt : Float -> Float -> Int
-                roundAt p x =
-                    -- [note] only makes sense for 0 <= x <= 1
-                    -- mod first to generalize?
-                    if x < p then
-                        floor x
-                    else
-                        ceiling x
-
-                yieldWithAvg : Float -> Random.Generator Int
-                yieldWithAvg avg =
-                    {- Write avg=n+p, where n=floor p.
-                       Yield either n or n+1 with probabilities
-                       P(n) = 1-p and P(n+1) = p.
-
-                       The average is then:
-                       n * (1-p) + (n+1) * p
-                       == n+p == avg
-                    -}
-                    let
-                        n =
-                            floor avg
-
-                        p =
-                            avg - toFloat n
-                    in
-                        Random.float 0 1
-                            |> Random.map
-                                (\s ->
-                                    if s < p then
-                                        -- this event has probability p
-                                        n + 1
-                                    else
-                                        -- this event has probability 1-p
-                                        n
-                                )
-
-                yield : Random.Generator (Material Int)
-                yield =
-                    let
-                        matRandom =
-                            Material.map2
-                                (always
-                                    (\avg c ->
-                                        yieldWithAvg avg
-                                            -- one yield per factory
-                                            |> Random.list c
-                                            |> Random.map List.sum
-                                    )
-                                )
-                                model.yieldRateModifier
-                                model.factories
-                    in
-                        Random.map4 Material
-                            matRandom.blueberry
-                            matRandom.tomato
-                            matRandom.corn
-                            matRandom.purple
-            in
-                ( model, Random.generate (toMsg << YieldRoll) yield )
-
         MoveToBasket fruit count ->
             updateIf trade
                 (\m model ->
@@ -333,63 +268,14 @@ handleTradeMsg { toGameServer, toMsg } msg model =
                 model
 
         SellButton fruit ->
-            case model.price of
-                Just price ->
-                    { model
-                        | gold =
-                            model.gold
-                                + floor (Material.lookup fruit price)
-                        , inventory =
-                            case
-                                Material.tryUpdate
-                                    fruit
-                                    (\x ->
-                                        let
-                                            newX =
-                                                x - 1
-                                        in
-                                            if newX >= 0 then
-                                                Just newX
-                                            else
-                                                Nothing
-                                    )
-                                    model.inventory
-                            of
-                                Nothing ->
-                                    Debug.crash
-                                        ("""Not enough item to sell.
-                                                    Sell button should've
-                                                    been disabled.""")
-
-                                Just inv ->
-                                    inv
-                    }
-                        ! [ toGameServer (Api.Sell fruit 1) ]
-
-                Nothing ->
-                    Debug.crash
-                        ("No price information."
-                            ++ "Sell button should have been disabled."
-                        )
+            -- The inventory and gold are updated once the server has
+            -- completed the sale.
+            model ! [ toGameServer (Api.Sell fruit 1) ]
 
         Shake ->
             tryUpdate trade
                 (\m ->
-                    m ! [ toGameServer (Api.Trade m.basket) ]
-                )
-                model
-
-        YieldRoll yield ->
-            updateIf trade
-                (\_ model ->
-                    { model
-                        | inventory =
-                            Material.map2
-                                (always (+))
-                                model.inventory
-                                yield
-                    }
-                        ! []
+                    m ! [ toGameServer (Api.Trade { materials = m.basket, money = 0 }) ]
                 )
                 model
 
@@ -403,13 +289,13 @@ handleAction action model =
         Api.GameStateChanged stage ->
             tryUpdate game (changeStage stage) model
 
-        Api.Auction seed ->
+        Api.Auction card ->
             tryUpdate (game |> goIn auction)
                 (\m ->
                     { m
                         | auction =
                             Just
-                                { card = Card.fromSeed seed
+                                { card = card
                                 , highestBid = Nothing
                                 , timer = Timer.init (5 * Time.second)
                                 }
@@ -512,9 +398,21 @@ handleAction action model =
                 )
                 model
 
-        Api.TradeCompleted mat ->
+        Api.TradeCompleted received ->
             tryUpdate (game |> goIn trade)
-                (\m -> { m | basket = mat } ! [])
+                (\m -> { m | basket = received.materials } ! [])
+                model
+
+        Api.InventoryUpdated inventory ->
+            tryUpdate game
+                (\m ->
+                    { m
+                        | gold = floor inventory.money
+                        , inventory = inventory.materials
+                        , factories = inventory.factories
+                    }
+                        ! []
+                )
                 model
 
         Api.GameOver winner ->
@@ -543,25 +441,7 @@ changeStage stage model =
                 TradeStageType ->
                     TradeStage initTradeModel ! []
     in
-        ( { model
-            | stage = newStage
-            , factories =
-                case model.stage of
-                    ProductionStage m ->
-                        case m.selected of
-                            Just selected ->
-                                Material.update selected
-                                    ((+) 1)
-                                    model.factories
-
-                            Nothing ->
-                                model.factories
-
-                    _ ->
-                        model.factories
-          }
-        , cmd
-        )
+        ( { model | stage = newStage }, cmd )
 
 
 
@@ -0,0 +1,302 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// AuctionType names one of the formats in which cards can be auctioned.
+type AuctionType string
+
+const (
+	// EnglishAuction is an open, ascending auction. Each higher bid resets
+	// the clock, and the card goes to the highest bidder once the bidding
+	// stops.
+	EnglishAuction AuctionType = "english"
+	// FirstPriceAuction is a sealed-bid auction. Players don't see each
+	// other's bids, and the highest bidder pays what they bid.
+	FirstPriceAuction AuctionType = "first_price"
+	// SecondPriceAuction is a sealed-bid (Vickrey) auction, in which the
+	// highest bidder pays the second highest bid.
+	SecondPriceAuction AuctionType = "second_price"
+	// DutchAuction is a descending auction. The asking price drops until
+	// somebody bids, and the first to do so pays the asking price.
+	DutchAuction AuctionType = "dutch"
+)
+
+// AuctionTypes lists every auction format, for validating configs.
+var AuctionTypes = []AuctionType{
+	EnglishAuction, FirstPriceAuction, SecondPriceAuction, DutchAuction}
+
+const (
+	// DutchSteps is the number of times that the asking price of a Dutch
+	// auction drops before it reaches the card's cost. The drops are spread
+	// evenly over the auction's bid time.
+	DutchSteps = 10
+	// DutchStartMultiple is how many times the card's cost the asking price
+	// of a Dutch auction starts at.
+	DutchStartMultiple = 3
+)
+
+const (
+	// KeepClock leaves the auction clock as it is.
+	KeepClock time.Duration = 0
+	// CloseAuction ends the auction of the current card straight away.
+	CloseAuction time.Duration = -1
+)
+
+// An AuctionFormat decides who wins each card that the AuctionController
+// puts up for auction, and what they pay. The controller draws the cards,
+// keeps the clock and settles the result, while the format handles the bids
+// and tells the players about them.
+type AuctionFormat interface {
+	// Open begins the auction of a card, and returns how long until the
+	// clock runs out.
+	Open(card Card) time.Duration
+	// Bid handles a player's bid, and returns a new time for the clock,
+	// KeepClock, or CloseAuction. The bid is refused if an error is
+	// returned.
+	Bid(u User, msg BidMessage) (time.Duration, error)
+	// Timer is called when the clock runs out, and returns a new time for
+	// it or CloseAuction.
+	Timer() time.Duration
+	// Leave forgets about a player who has left the game.
+	Leave(u User)
+	// Result returns the winner of the card, or nil if nobody won it, the
+	// price that they pay, and the bid that won.
+	Result() (winner User, price int, bid BidMessage)
+	// Info describes the auction so far, as any player may see it.
+	Info() AuctionInfo
+}
+
+// NewAuctionFormat creates the format of auction which the game is
+// configured to use.
+func NewAuctionFormat(game *Game) AuctionFormat {
+	switch game.Config.AuctionFormat {
+	case FirstPriceAuction:
+		return &SealedBidding{game: game}
+	case SecondPriceAuction:
+		return &SealedBidding{game: game, secondPrice: true}
+	case DutchAuction:
+		return &DutchBidding{game: game}
+	default:
+		return &EnglishBidding{game: game}
+	}
+}
+
+// checkBid returns an error if a player can't make a bid of the given amount
+// for a card.
+func checkBid(game *Game, u User, card Card, amount int) error {
+	if !game.Ledger.CanAfford(u, float64(amount)) {
+		return NewGameError(InsufficientFundsError,
+			"Can't afford a bid of %v", amount)
+	}
+	if amount < card.Cost {
+		return NewGameError(InvalidRequestError,
+			"The minimum bid for %q is %v", card.Name, card.Cost)
+	}
+	return nil
+}
+
+// EnglishBidding runs an EnglishAuction. Every bid is announced, and a higher
+// bid resets the clock.
+type EnglishBidding struct {
+	game   *Game
+	card   Card
+	bid    BidMessage
+	winner User
+}
+
+func (a *EnglishBidding) Open(card Card) time.Duration {
+	*a = EnglishBidding{game: a.game, card: card}
+	return milliseconds(a.game.Config.AuctionBidTime)
+}
+
+func (a *EnglishBidding) Bid(u User, msg BidMessage) (time.Duration, error) {
+	if err := checkBid(a.game, u, a.card, msg.Amount); err != nil {
+		return KeepClock, err
+	}
+	if msg.Amount <= a.bid.Amount {
+		return KeepClock, nil
+	}
+	a.bid = msg
+	a.winner = u
+
+	// Update everyone on the new bid and winner.
+	a.game.connection.Broadcast(NewBidUpdatedMessage(msg.Amount, u.Name(), msg.ID))
+	return milliseconds(a.game.Config.AuctionBidTime), nil
+}
+
+func (a *EnglishBidding) Timer() time.Duration { return CloseAuction }
+
+func (a *EnglishBidding) Leave(u User) {
+	if a.winner == u {
+		// The highest bidder can't pay for the card once they've left,
+		// so the bidding starts over.
+		a.bid = BidMessage{}
+		a.winner = nil
+		a.game.connection.Broadcast(NewBidUpdatedMessage(0, "", ""))
+	}
+}
+
+func (a *EnglishBidding) Result() (User, int, BidMessage) {
+	return a.winner, a.bid.Amount, a.bid
+}
+
+func (a *EnglishBidding) Info() AuctionInfo {
+	info := AuctionInfo{Card: a.card, Bid: a.bid.Amount}
+	if a.winner != nil {
+		info.Winner = a.winner.Name()
+	}
+	return info
+}
+
+// sealedBid is a bid which the other players can't see.
+type sealedBid struct {
+	user User
+	msg  BidMessage
+}
+
+// SealedBidding runs a FirstPriceAuction, or a SecondPriceAuction if
+// secondPrice is set. Each player may bid once, or change their bid, until
+// the clock runs out, and is told privately that their bid was received.
+// The winning bid and price are announced at the end. Ties go to whoever
+// bid first.
+type SealedBidding struct {
+	game        *Game
+	card        Card
+	secondPrice bool
+	// bids are kept in the order that they were made.
+	bids []sealedBid
+}
+
+func (a *SealedBidding) Open(card Card) time.Duration {
+	a.card = card
+	a.bids = nil
+	return milliseconds(a.game.Config.AuctionBidTime)
+}
+
+func (a *SealedBidding) Bid(u User, msg BidMessage) (time.Duration, error) {
+	if err := checkBid(a.game, u, a.card, msg.Amount); err != nil {
+		return KeepClock, err
+	}
+	// A new bid replaces the player's last one.
+	a.Leave(u)
+	a.bids = append(a.bids, sealedBid{u, msg})
+	u.Message(NewBidReceivedMessage(msg))
+	return KeepClock, nil
+}
+
+func (a *SealedBidding) Timer() time.Duration {
+	if winner, price, bid := a.Result(); winner != nil {
+		a.game.connection.Broadcast(NewBidUpdatedMessage(price, winner.Name(), bid.ID))
+	}
+	return CloseAuction
+}
+
+func (a *SealedBidding) Leave(u User) {
+	for i, b := range a.bids {
+		if b.user == u {
+			a.bids = append(a.bids[:i], a.bids[i+1:]...)
+			return
+		}
+	}
+}
+
+func (a *SealedBidding) Result() (User, int, BidMessage) {
+	if len(a.bids) == 0 {
+		return nil, 0, BidMessage{}
+	}
+	bids := append([]sealedBid(nil), a.bids...)
+	sort.SliceStable(bids, func(i, j int) bool {
+		return bids[i].msg.Amount > bids[j].msg.Amount
+	})
+	winner := bids[0]
+	if !a.secondPrice {
+		return winner.user, winner.msg.Amount, winner.msg
+	}
+	// Without a second bid, the winner pays the least that anybody could.
+	price := a.card.Cost
+	if len(bids) > 1 {
+		price = bids[1].msg.Amount
+	}
+	return winner.user, price, winner.msg
+}
+
+// Info doesn't give away any of the bids.
+func (a *SealedBidding) Info() AuctionInfo {
+	return AuctionInfo{Card: a.card}
+}
+
+// DutchBidding runs a DutchAuction. The asking price is announced each time
+// that it drops, and the first player to bid at least the asking price wins
+// the card at that price. Nobody wins it if the price drops to the card's
+// cost and stays there until the clock runs out.
+type DutchBidding struct {
+	game   *Game
+	card   Card
+	start  int
+	step   int
+	bid    BidMessage
+	winner User
+}
+
+// Price returns the current asking price.
+func (a *DutchBidding) Price() int {
+	return a.start - (a.start-a.card.Cost)*a.step/DutchSteps
+}
+
+// interval returns the time between drops in the asking price.
+func (a *DutchBidding) interval() time.Duration {
+	return milliseconds(a.game.Config.AuctionBidTime) / DutchSteps
+}
+
+func (a *DutchBidding) Open(card Card) time.Duration {
+	*a = DutchBidding{game: a.game, card: card}
+	// The price has to start high enough to drop at every step.
+	a.start = card.Cost * DutchStartMultiple
+	if a.start < card.Cost+DutchSteps {
+		a.start = card.Cost + DutchSteps
+	}
+	a.game.connection.Broadcast(NewAuctionPriceMessage(a.Price()))
+	return a.interval()
+}
+
+func (a *DutchBidding) Bid(u User, msg BidMessage) (time.Duration, error) {
+	price := a.Price()
+	if msg.Amount < price {
+		return KeepClock, NewGameError(InvalidRequestError,
+			"The asking price for %q is %v", a.card.Name, price)
+	}
+	if err := checkBid(a.game, u, a.card, price); err != nil {
+		return KeepClock, err
+	}
+	a.bid = msg
+	a.winner = u
+	a.game.connection.Broadcast(NewBidUpdatedMessage(price, u.Name(), msg.ID))
+	return CloseAuction, nil
+}
+
+func (a *DutchBidding) Timer() time.Duration {
+	if a.step == DutchSteps {
+		return CloseAuction
+	}
+	a.step++
+	a.game.connection.Broadcast(NewAuctionPriceMessage(a.Price()))
+	return a.interval()
+}
+
+func (a *DutchBidding) Leave(u User) {}
+
+func (a *DutchBidding) Result() (User, int, BidMessage) {
+	return a.winner, a.Price(), a.bid
+}
+
+func (a *DutchBidding) Info() AuctionInfo {
+	info := AuctionInfo{Card: a.card, Price: a.Price()}
+	if a.winner != nil {
+		info.Bid = a.Price()
+		info.Winner = a.winner.Name()
+	}
+	return info
+}
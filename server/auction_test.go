@@ -0,0 +1,177 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestAuction starts an auction of a single card in the given format.
+func newTestAuction(format AuctionType, card Card) (*Game, *AuctionController) {
+	config := DefaultGameConfig()
+	config.AuctionFormat = format
+	config.NumberOfBids = 1
+	game := NewGame("g", &TestConnection{}, config)
+	game.Deck = NewDeck([]Card{card}, seeded())
+	ctrl := NewAuctionController(game)
+	game.state = ctrl
+	ctrl.Begin()
+	return game, ctrl
+}
+
+// broadcasted returns true if the message was broadcast on the connection
+// since it was last cleared.
+func broadcasted(c *TestConnection, m Message) bool {
+	want := TestConnection{}
+	want.Broadcast(m)
+	for _, got := range c.broadcastLog {
+		if got == want.broadcastLog[0] {
+			return true
+		}
+	}
+	return false
+}
+
+func TestSealedBidAuctions(t *testing.T) {
+	tests := []struct {
+		format AuctionType
+		bids   []int
+		winner int
+		price  int
+	}{
+		{FirstPriceAuction, []int{5, 12, 8}, 1, 12},
+		{SecondPriceAuction, []int{5, 12, 8}, 1, 8},
+		// Ties go to whoever bid first.
+		{FirstPriceAuction, []int{7, 9, 9}, 1, 9},
+		{SecondPriceAuction, []int{7, 9, 9}, 1, 9},
+		// A lone bidder pays the card's cost.
+		{SecondPriceAuction, []int{6}, 0, 2},
+	}
+
+	for _, test := range tests {
+		game, ctrl := newTestAuction(test.format, Card{Name: "Plow", Cost: 2})
+		users := make([]*TestUser, len(test.bids))
+		for i, bid := range test.bids {
+			users[i] = &TestUser{}
+			ctrl.RecieveMessage(users[i], NewBidMessage(bid))
+		}
+
+		// Bids are acknowledged privately, and not announced.
+		connection := game.connection.(*TestConnection)
+		for i, u := range users {
+			if _, ok := DecodeLastMessage(t, u).(BidReceivedMessage); !ok {
+				t.Errorf("%v: user %v was sent %q, want bid_received", test.format, i, u.messageLog)
+			}
+		}
+		if info := ctrl.format.Info(); info.Bid != 0 || info.Winner != "" {
+			t.Errorf("%v: Info() = %+v, gives away the bids", test.format, info)
+		}
+
+		game.Tick(2 * AuctionBidTime)
+		winner := users[test.winner]
+		if _, ok := DecodeLastMessage(t, winner).(AuctionWonMessage); !ok {
+			t.Errorf("%v %v: winner was sent %q", test.format, test.bids, winner.messageLog)
+		}
+		if got := game.Ledger.Account(winner).Money; got != StartingMoney-float64(test.price) {
+			t.Errorf("%v %v: winner paid %v, want %v",
+				test.format, test.bids, StartingMoney-got, test.price)
+		}
+		if !broadcasted(connection, NewBidUpdatedMessage(test.price, "", "")) {
+			t.Errorf("%v %v: the result wasn't announced: %q",
+				test.format, test.bids, connection.broadcastLog)
+		}
+	}
+}
+
+func TestSealedBidChangesAndLeaves(t *testing.T) {
+	_, ctrl := newTestAuction(FirstPriceAuction, Card{Name: "Plow"})
+	a := &TestUser{}
+	b := &TestUser{}
+	ctrl.RecieveMessage(a, NewBidMessage(10))
+	ctrl.RecieveMessage(b, NewBidMessage(8))
+
+	// A player may lower their bid.
+	ctrl.RecieveMessage(a, NewBidMessage(4))
+	if winner, price, _ := ctrl.format.Result(); winner != b || price != 8 {
+		t.Errorf("Result() = %v, %v, want b, 8", winner, price)
+	}
+
+	// A player who leaves can't win.
+	ctrl.RecieveMessage(b, NewLeaveMessage())
+	if winner, price, _ := ctrl.format.Result(); winner != a || price != 4 {
+		t.Errorf("Result() = %v, %v, want a, 4", winner, price)
+	}
+
+	// Bids are still checked against the ledger.
+	ctrl.RecieveMessage(a, NewBidMessage(int(StartingMoney)+1))
+	if _, ok := DecodeLastMessage(t, a).(ErrorMessage); !ok {
+		t.Errorf("Expected an error message, got %q", a.messageLog)
+	}
+}
+
+func TestDutchAuction(t *testing.T) {
+	game, ctrl := newTestAuction(DutchAuction, Card{Name: "Plow", Cost: 5})
+	connection := game.connection.(*TestConnection)
+	interval := AuctionBidTime / DutchSteps
+
+	// The price starts at three times the cost and drops by a tenth of
+	// the difference at each step.
+	if !broadcasted(connection, NewAuctionPriceMessage(15)) {
+		t.Errorf("Opening price wasn't 15: %q", connection.broadcastLog)
+	}
+	game.Tick(interval + 1)
+	game.Tick(2*interval + 2)
+	if got := ctrl.format.(*DutchBidding).Price(); got != 13 {
+		t.Errorf("Price after two drops = %v, want 13", got)
+	}
+	if !broadcasted(connection, NewAuctionPriceMessage(14)) ||
+		!broadcasted(connection, NewAuctionPriceMessage(13)) {
+		t.Errorf("Price drops weren't announced: %q", connection.broadcastLog)
+	}
+
+	// Bidding below the asking price is refused.
+	early := &TestUser{}
+	ctrl.RecieveMessage(early, NewBidMessage(12))
+	if _, ok := DecodeLastMessage(t, early).(ErrorMessage); !ok {
+		t.Errorf("Expected an error message, got %q", early.messageLog)
+	}
+
+	// The first player to take the asking price wins at that price, even if
+	// they offered more.
+	user := &TestUser{name: "taker"}
+	other := &TestUser{}
+	ctrl.RecieveMessage(user, NewBidMessage(20))
+	if _, ok := DecodeLastMessage(t, user).(AuctionWonMessage); !ok {
+		t.Errorf("taker was sent %q, want auction_won", user.messageLog)
+	}
+	if got := game.Ledger.Account(user).Money; got != StartingMoney-13 {
+		t.Errorf("taker's money = %v, want %v", got, StartingMoney-13)
+	}
+	if got := game.state.Name(); got != TradeState {
+		t.Errorf("State = %v, want %v", got, TradeState)
+	}
+	// Nobody else can take it afterwards.
+	game.RecieveMessage(other, NewBidMessage(20))
+	if got := game.Ledger.Account(other).Money; got != StartingMoney {
+		t.Errorf("A second taker was charged: %v", got)
+	}
+}
+
+func TestDutchAuctionUnsold(t *testing.T) {
+	game, ctrl := newTestAuction(DutchAuction, Card{Name: "Dud"})
+	interval := AuctionBidTime / DutchSteps
+
+	// With no cost, the price starts at DutchSteps and drops by one.
+	for i := 1; i <= DutchSteps; i++ {
+		game.Tick(interval*time.Duration(i) + time.Duration(i))
+	}
+	if got := ctrl.format.(*DutchBidding).Price(); got != 0 {
+		t.Errorf("Final price = %v, want 0", got)
+	}
+	if got := game.state.Name(); got != AuctionState {
+		t.Errorf("State = %v before the clock runs out, want %v", got, AuctionState)
+	}
+	game.Tick(interval*(DutchSteps+1) + DutchSteps + 1)
+	if got := game.state.Name(); got != TradeState {
+		t.Errorf("State = %v, want %v", got, TradeState)
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+)
+
+var (
+	// AllCards is the catalogue of cards which can be put up for auction.
+	// It is loaded from a data file when the server starts.
+	AllCards []Card
+)
+
+// A Card is put up for auction during the auction phase. When the auction
+// ends, the server applies the card's effects to the game on behalf of the
+// winner.
+type Card struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Cost is the minimum bid that will be accepted for the card.
+	Cost              int                       `json:"cost"`
+	YieldRateModifier map[CommodityType]float64 `json:"yield_rate_modifier"`
+	PriceModifier     map[CommodityType]float64 `json:"price_modifier"`
+	// Duration is how long, in milliseconds, the effects of the card last.
+	// Zero means that the effects are permanent.
+	Duration int64 `json:"duration_ms"`
+}
+
+// Effect returns the effect that the card has on the game once it is won.
+func (c Card) Effect() ApplyEffectMessage {
+	return ApplyEffectMessage{
+		Action:            string(ApplyEffectAction),
+		Name:              c.Name,
+		YieldRateModifier: c.YieldRateModifier,
+		PriceModifier:     c.PriceModifier,
+		Timeout:           c.Duration,
+	}
+}
+
+// LoadCards reads a catalogue of cards from a JSON file containing a list of
+// cards.
+func LoadCards(path string) ([]Card, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cards []Card
+	if err := json.Unmarshal(data, &cards); err != nil {
+		return nil, fmt.Errorf("Unable to decode cards in %v: %v", path, err)
+	}
+	for _, c := range cards {
+		if c.Cost < 0 || c.Duration < 0 {
+			return nil, fmt.Errorf("Invalid card %q in %v", c.Name, path)
+		}
+	}
+	return cards, nil
+}
+
+// A Deck deals cards from a catalogue in a random order. Once every card has
+// been dealt, the catalogue is shuffled again.
+type Deck struct {
+	catalogue []Card
+	cards     []Card
+	rand      *rand.Rand
+}
+
+// NewDeck constructs a deck from a catalogue of cards, which is shuffled using
+// the given source of randomness.
+func NewDeck(catalogue []Card, r *rand.Rand) *Deck {
+	d := &Deck{catalogue: catalogue, rand: r}
+	d.shuffle()
+	return d
+}
+
+func (d *Deck) shuffle() {
+	d.cards = make([]Card, len(d.catalogue))
+	for i, j := range d.rand.Perm(len(d.catalogue)) {
+		d.cards[i] = d.catalogue[j]
+	}
+}
+
+// Draw deals the next card from the deck. It returns false if there are no
+// cards in the catalogue.
+func (d *Deck) Draw() (Card, bool) {
+	if len(d.cards) == 0 {
+		d.shuffle()
+	}
+	if len(d.cards) == 0 {
+		return Card{}, false
+	}
+
+	card := d.cards[0]
+	d.cards = d.cards[1:]
+	return card, true
+}
@@ -0,0 +1,48 @@
+package main
+
+import "testing"
+
+func TestLoadCards(t *testing.T) {
+	cards, err := LoadCards("data/cards.json")
+	if err != nil {
+		t.Fatalf("LoadCards(...) returned err: %v", err)
+	}
+	if len(cards) == 0 {
+		t.Errorf("LoadCards(...) returned no cards")
+	}
+	for _, c := range cards {
+		if c.Name == "" {
+			t.Errorf("LoadCards(...) returned a card with no name: %v", c)
+		}
+	}
+}
+
+func TestDeckDealsEveryCard(t *testing.T) {
+	d := NewDeck(testCards, seeded())
+
+	// Every card is dealt exactly once before the deck is reshuffled.
+	seen := map[string]int{}
+	for range testCards {
+		card, ok := d.Draw()
+		if !ok {
+			t.Fatalf("d.Draw() returned no card")
+		}
+		seen[card.Name]++
+	}
+	for _, c := range testCards {
+		if seen[c.Name] != 1 {
+			t.Errorf("card %q was dealt %v times, want 1", c.Name, seen[c.Name])
+		}
+	}
+
+	if _, ok := d.Draw(); !ok {
+		t.Errorf("d.Draw() returned no card after reshuffling")
+	}
+}
+
+func TestEmptyDeck(t *testing.T) {
+	d := NewDeck(nil, seeded())
+	if _, ok := d.Draw(); ok {
+		t.Errorf("d.Draw() returned a card from an empty deck")
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"time"
+)
+
+const (
+	// MaxPhaseTime is the longest that any timed part of a game can be
+	// configured to last.
+	MaxPhaseTime time.Duration = time.Hour
+	// MaxTimeLimit is the longest time limit that a game can be configured
+	// to have.
+	MaxTimeLimit time.Duration = 24 * time.Hour
+	// MaxConfiguredPlayers is the largest minimum number of players that a
+	// game can be configured to wait for.
+	MaxConfiguredPlayers int = 100
+	// MaxConfiguredBids is the largest number of cards that a game can be
+	// configured to put up for auction each round.
+	MaxConfiguredBids int = 100
+)
+
+// TradeMode says how a bump trade is settled once two offers are paired.
+type TradeMode string
+
+const (
+	// InstantTrades settle as soon as the offers are paired, like a fist
+	// bump.
+	InstantTrades TradeMode = "instant"
+	// ConfirmedTrades show each player what the other is offering, and only
+	// settle once both have accepted.
+	ConfirmedTrades TradeMode = "confirm"
+)
+
+// GameConfig holds the rules of a single game, so that short demo games and
+// long tournament games can be run from the same server. All times are in
+// milliseconds.
+type GameConfig struct {
+	ProductionTime int64 `json:"production_time_ms"`
+	AuctionBidTime int64 `json:"auction_bid_time_ms"`
+	NumberOfBids   int   `json:"number_of_bids"`
+	// AuctionFormat is how the cards are auctioned. AuctionBidTime is the
+	// time after the last bid in an English auction, and the length of the
+	// auction otherwise.
+	AuctionFormat AuctionType `json:"auction_format"`
+	TradingTime   int64       `json:"trading_time_ms"`
+	TradeTimeout  int64       `json:"trade_timeout_ms"`
+	MinPlayers    int         `json:"min_players"`
+
+	// TradeMode chooses how bump trades are settled. With ConfirmedTrades,
+	// both players must accept a proposed trade within ProposalTime.
+	TradeMode    TradeMode `json:"trade_mode"`
+	ProposalTime int64     `json:"proposal_time_ms"`
+
+	// The game ends once any of the end conditions is met. Zero means that
+	// the condition is never met, so by default games go on forever.
+	MaxRounds    int     `json:"max_rounds"`
+	TargetWealth float64 `json:"target_wealth"`
+	TimeLimit    int64   `json:"time_limit_ms"`
+
+	// SupplyRecovery is the fraction of surplus supply which the market
+	// consumes between rounds, and DemandDrift is the size of the random
+	// walk which demand takes between rounds. See Market.Evolve.
+	SupplyRecovery float64 `json:"supply_recovery"`
+	DemandDrift    float64 `json:"demand_drift"`
+
+	// Commodities are the commodities which the game is played with, and
+	// the starting state of the market for each of them. They come from the
+	// catalogue which the server loads, and can't be set by game creators,
+	// who are told about them in the welcome message instead.
+	Commodities []CommodityInfo `json:"-"`
+}
+
+// DefaultGameConfig returns the rules used when the creator of a game doesn't
+// ask for anything different.
+func DefaultGameConfig() GameConfig {
+	return GameConfig{
+		ProductionTime: int64(ProductionTimeout / time.Millisecond),
+		AuctionBidTime: int64(AuctionBidTime / time.Millisecond),
+		NumberOfBids:   NumberOfBids,
+		AuctionFormat:  EnglishAuction,
+		TradingTime:    int64(TradingStageTime / time.Millisecond),
+		TradeTimeout:   int64(TradeTimeout / time.Millisecond),
+		MinPlayers:     MinPlayers,
+		TradeMode:      InstantTrades,
+		ProposalTime:   int64(ProposalTime / time.Millisecond),
+		SupplyRecovery: SupplyRecovery,
+		DemandDrift:    DemandDrift,
+		// The catalogue is copied, so that decoding a config on top of
+		// the defaults can't change the catalogue.
+		Commodities: append([]CommodityInfo(nil), AllCommodities...),
+	}
+}
+
+// ParseGameConfig decodes a JSON object of rules. Rules which aren't given
+// keep their default values.
+func ParseGameConfig(data string) (GameConfig, error) {
+	c := DefaultGameConfig()
+	d := json.NewDecoder(bytes.NewReader([]byte(data)))
+	d.DisallowUnknownFields()
+	if err := d.Decode(&c); err != nil {
+		return GameConfig{}, NewGameError(InvalidRequestError,
+			"Unable to decode game config: %v", err)
+	}
+	if err := c.Validate(); err != nil {
+		return GameConfig{}, err
+	}
+	return c, nil
+}
+
+// Validate returns an error if the rules don't make for a playable game.
+func (c GameConfig) Validate() error {
+	times := []struct {
+		name string
+		ms   int64
+	}{
+		{"production_time_ms", c.ProductionTime},
+		{"auction_bid_time_ms", c.AuctionBidTime},
+		{"trading_time_ms", c.TradingTime},
+		{"trade_timeout_ms", c.TradeTimeout},
+		{"proposal_time_ms", c.ProposalTime},
+	}
+	// The times are compared in milliseconds, since converting a huge time
+	// to a Duration would overflow.
+	for _, t := range times {
+		if t.ms <= 0 || t.ms > int64(MaxPhaseTime/time.Millisecond) {
+			return NewGameError(InvalidRequestError,
+				"Invalid %v: %v", t.name, t.ms)
+		}
+	}
+
+	if !validAuctionType(c.AuctionFormat) {
+		return NewGameError(InvalidRequestError,
+			"Invalid auction_format: %q", c.AuctionFormat)
+	}
+	if c.TradeMode != InstantTrades && c.TradeMode != ConfirmedTrades {
+		return NewGameError(InvalidRequestError,
+			"Invalid trade_mode: %q", c.TradeMode)
+	}
+	if c.NumberOfBids < 0 || c.NumberOfBids > MaxConfiguredBids {
+		return NewGameError(InvalidRequestError,
+			"Invalid number_of_bids: %v", c.NumberOfBids)
+	}
+	if c.MinPlayers < 1 || c.MinPlayers > MaxConfiguredPlayers {
+		return NewGameError(InvalidRequestError,
+			"Invalid min_players: %v", c.MinPlayers)
+	}
+	if c.SupplyRecovery < 0 || c.SupplyRecovery > 1 {
+		return NewGameError(InvalidRequestError,
+			"Invalid supply_recovery: %v", c.SupplyRecovery)
+	}
+	if c.DemandDrift < 0 || c.DemandDrift > 1 {
+		return NewGameError(InvalidRequestError,
+			"Invalid demand_drift: %v", c.DemandDrift)
+	}
+	if c.MaxRounds < 0 {
+		return NewGameError(InvalidRequestError,
+			"Invalid max_rounds: %v", c.MaxRounds)
+	}
+	if c.TargetWealth < 0 {
+		return NewGameError(InvalidRequestError,
+			"Invalid target_wealth: %v", c.TargetWealth)
+	}
+	if c.TimeLimit < 0 || c.TimeLimit > int64(MaxTimeLimit/time.Millisecond) {
+		return NewGameError(InvalidRequestError,
+			"Invalid time_limit_ms: %v", c.TimeLimit)
+	}
+	return ValidateCommodities(c.Commodities)
+}
+
+// validAuctionType returns true if t is one of the AuctionTypes.
+func validAuctionType(t AuctionType) bool {
+	for _, a := range AuctionTypes {
+		if a == t {
+			return true
+		}
+	}
+	return false
+}
+
+// milliseconds converts a time from a config or message into a Duration.
+func milliseconds(ms int64) time.Duration {
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseGameConfig(t *testing.T) {
+	got, err := ParseGameConfig(`{"production_time_ms": 2000, "number_of_bids": 1}`)
+	if err != nil {
+		t.Fatalf("ParseGameConfig() failed: %v", err)
+	}
+	want := DefaultGameConfig()
+	want.ProductionTime = 2000
+	want.NumberOfBids = 1
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Config differs (-want +got):\n%v", diff)
+	}
+
+	invalid := []string{
+		`{"production_time_ms": 0}`,
+		`{"trade_timeout_ms": -1}`,
+		`{"trading_time_ms": 360000000}`,
+		`{"production_time_ms": 9223372036855}`,
+		`{"time_limit_ms": -1}`,
+		`{"time_limit_ms": 9223372036855}`,
+		`{"number_of_bids": -1}`,
+		`{"min_players": 0}`,
+		`{"trade_mode": "haggle"}`,
+		`{"auction_format": "silent"}`,
+		`{"proposal_time_ms": 0}`,
+		`{"commodities": []}`,
+		`{"commodities": [{"id": "corn", "value": 0, "demand": 1}]}`,
+		`{"unknown_rule": 1}`,
+		`not json`,
+	}
+	for _, data := range invalid {
+		if _, err := ParseGameConfig(data); ErrorCodeOf(err) != InvalidRequestError {
+			t.Errorf("ParseGameConfig(%v) = %v, want %v", data, err, InvalidRequestError)
+		}
+	}
+}
+
+func TestConfiguredGame(t *testing.T) {
+	config := DefaultGameConfig()
+	config.ProductionTime = 2000
+	config.NumberOfBids = 0
+	config.TradingTime = 3000
+	config.Commodities = []CommodityInfo{
+		{ID: Corn, Name: "Corn", Value: 10, Demand: 100, Supply: 0},
+	}
+
+	connection := TestConnection{}
+	game := NewGame("g", &connection, config)
+	if got := game.Market.Prices()[Corn]; got != 10 {
+		t.Errorf("Price of corn = %v, want 10", got)
+	}
+
+	// The game skips straight past the auction phase.
+	game.ChangeState(ProductionState)
+	game.Tick(2*time.Second + 1)
+	if got := game.state.Name(); got != TradeState {
+		t.Errorf("State after production = %v, want %v", got, TradeState)
+	}
+	want, _ := json.Marshal(NewSetClockMessage(3 * time.Second))
+	if got := connection.broadcastLog[len(connection.broadcastLog)-1]; got != string(want) {
+		t.Errorf("Last broadcast = %v, want %v", got, string(want))
+	}
+}
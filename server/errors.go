@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// ErrorCode identifies the kind of problem reported by an ErrorMessage, so
+// that clients can react to it without having to parse the text.
+type ErrorCode string
+
+const (
+	// InvalidMessageError means that the message couldn't be decoded.
+	InvalidMessageError ErrorCode = "invalid_message"
+	// UnknownActionError means that the server doesn't recognize the action.
+	UnknownActionError ErrorCode = "unknown_action"
+	// ForbiddenError means that the player isn't permitted to send the action.
+	ForbiddenError ErrorCode = "forbidden"
+	// WrongPhaseError means that the action can't be taken in the current
+	// phase of the game, e.g. bidding during the trade phase.
+	WrongPhaseError ErrorCode = "wrong_phase"
+	// InvalidRequestError means that the message was understood, but its
+	// contents don't make sense, e.g. a negative quantity.
+	InvalidRequestError ErrorCode = "invalid_request"
+	// InsufficientFundsError means that the player doesn't have enough money.
+	InsufficientFundsError ErrorCode = "insufficient_funds"
+	// InsufficientMaterialsError means that the player doesn't hold enough of
+	// the materials.
+	InsufficientMaterialsError ErrorCode = "insufficient_materials"
+)
+
+// A GameError is an error which can be reported back to the player whose
+// message caused it.
+type GameError struct {
+	Code ErrorCode
+	Text string
+}
+
+// NewGameError constructs a GameError with a formatted description.
+func NewGameError(code ErrorCode, format string, args ...interface{}) *GameError {
+	return &GameError{
+		Code: code,
+		Text: fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *GameError) Error() string {
+	return e.Text
+}
+
+// ErrorCodeOf returns the code of an error. Errors which aren't GameErrors
+// are treated as invalid requests.
+func ErrorCodeOf(err error) ErrorCode {
+	if e, ok := err.(*GameError); ok {
+		return e.Code
+	}
+	return InvalidRequestError
+}
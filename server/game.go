@@ -2,6 +2,8 @@ package main
 
 import (
 	"log"
+	"math/rand"
+	"sort"
 	"time"
 )
 
@@ -26,24 +28,50 @@ type Game struct {
 	nextTimeout time.Duration
 	tick        time.Duration
 	Market      Market
-	MinPlayers  int
+	Ledger      *Ledger
+	Deck        *Deck
+	Config      GameConfig
 	Yield       map[CommodityType]float64
+	effects     []*ActiveEffect
+	// rand is the source of randomness for the deck and the market.
+	rand *rand.Rand
+
+	// Round counts the rounds which have begun, starting from one when the
+	// first production phase begins.
+	Round     int
+	stats     *roundStats
+	startedAt time.Duration
+	endReason string
+}
+
+// An ActiveEffect is an effect which has been applied to the game, and whose
+// modifiers will be reversed when it expires.
+type ActiveEffect struct {
+	Name              string
+	YieldRateModifier map[CommodityType]float64
+	PriceModifier     map[CommodityType]float64
+	Expires           time.Duration
 }
 
-// NewGame constructs a game.
-func NewGame(name string, connection GameConnection) *Game {
+// NewGame constructs a game which is played by the given rules.
+func NewGame(name string, connection GameConnection, config GameConfig) *Game {
+	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	game := Game{
 		name:       name,
 		connection: connection,
 		state:      nil,
-		Market:     NewMarket(),
+		Market:     NewMarket(config.Commodities),
+		Ledger:     NewLedger(),
+		Deck:       NewDeck(AllCards, r),
+		Config:     config,
 		Yield:      make(map[CommodityType]float64),
-		MinPlayers: MinPlayers,
+		rand:       r,
 	}
+	game.stats = newRoundStats(game.Market.Prices())
 	game.state = NewStateController(&game, WaitingState)
 	game.state.Begin()
 
-	for _, c := range AllCommodities {
+	for _, c := range game.Market.Types() {
 		game.Yield[c] = 1.00
 	}
 
@@ -66,31 +94,202 @@ func (g *Game) GetTime() time.Duration {
 // Tick is called each time that the tick interval elapses.
 func (g *Game) Tick(time time.Duration) {
 	g.tick = time
+	g.expireEffects()
+
+	// Some states need to hear about every tick.
+	if t, ok := g.state.(Ticker); ok {
+		t.Tick(time)
+	}
 
 	// If a timer is currently set, notify the state controller.
 	if g.nextTimeout != 0 && time > g.nextTimeout {
 		g.nextTimeout = 0
 		g.state.Timer(time)
 	}
+
+	// The time limit can run out part way through a round.
+	limit := milliseconds(g.Config.TimeLimit)
+	if g.Round > 0 && g.state.Name() != GameOverState &&
+		limit > 0 && g.tick-g.startedAt >= limit {
+		g.endGame(TimeLimitReason)
+	}
+}
+
+// EndRound is called when the trading phase is over. It ends the game if the
+// rounds are up or somebody has become rich enough, and otherwise begins the
+// next round.
+func (g *Game) EndRound() {
+	g.connection.Broadcast(g.RoundSummary())
+
+	if g.Config.MaxRounds > 0 && g.Round >= g.Config.MaxRounds {
+		g.endGame(MaxRoundsReason)
+		return
+	}
+	if g.Config.TargetWealth > 0 {
+		for _, u := range g.Ledger.Users() {
+			if g.NetWorth(u) >= g.Config.TargetWealth {
+				g.endGame(TargetWealthReason)
+				return
+			}
+		}
+	}
+	g.ChangeState(ProductionState)
+}
+
+func (g *Game) endGame(reason string) {
+	log.Printf("Game %q is over: %v", g.name, reason)
+	g.endReason = reason
+	g.ChangeState(GameOverState)
+}
+
+// NetWorth is the value of everything a user holds: their money, plus their
+// materials at the current market prices.
+func (g *Game) NetWorth(u User) float64 {
+	account := g.Ledger.Account(u)
+	prices := g.Market.Prices()
+
+	worth := account.Money
+	for t, q := range account.Materials {
+		worth += float64(q) * prices[t]
+	}
+	return worth
 }
 
+// Standings ranks every player by their net worth, richest first. Players
+// with the same net worth share a rank.
+func (g *Game) Standings() []Standing {
+	var standings []Standing
+	for _, u := range g.Ledger.Users() {
+		account := g.Ledger.Account(u)
+		standings = append(standings, Standing{
+			Name:      u.Name(),
+			NetWorth:  g.NetWorth(u),
+			Money:     account.Money,
+			Materials: account.Materials,
+		})
+	}
+	sort.Slice(standings, func(i, j int) bool {
+		if standings[i].NetWorth != standings[j].NetWorth {
+			return standings[i].NetWorth > standings[j].NetWorth
+		}
+		return standings[i].Name < standings[j].Name
+	})
+	for i := range standings {
+		if i > 0 && standings[i].NetWorth == standings[i-1].NetWorth {
+			standings[i].Rank = standings[i-1].Rank
+		} else {
+			standings[i].Rank = i + 1
+		}
+	}
+	return standings
+}
+
+// ApplyEffects multiplies the yield rates and market prices by the modifiers
+// in the message. Commodities without a modifier are left unchanged. If the
+// message has a timeout, the effect is reversed once the timeout elapses.
 func (g *Game) ApplyEffects(msg ApplyEffectMessage) {
+	for _, modifiers := range []map[CommodityType]float64{
+		msg.YieldRateModifier, msg.PriceModifier,
+	} {
+		for c, m := range modifiers {
+			if m <= 0 {
+				log.Printf("Ignoring effect with invalid modifier for %v: %v", c, m)
+				return
+			}
+		}
+	}
+
 	g.Market.ApplyModifier(msg.PriceModifier)
+	for _, c := range g.Market.Types() {
+		if modifier, ok := msg.YieldRateModifier[c]; ok {
+			g.Yield[c] *= modifier
+		}
+	}
 
-	for _, c := range AllCommodities {
-		g.Yield[c] *= msg.YieldRateModifier[c]
+	if msg.Timeout > 0 {
+		g.effects = append(g.effects, &ActiveEffect{
+			Name:              msg.Name,
+			YieldRateModifier: msg.YieldRateModifier,
+			PriceModifier:     msg.PriceModifier,
+			Expires:           g.tick + time.Duration(msg.Timeout)*time.Millisecond,
+		})
 	}
 
 	// Inform the consumers that the effects are updated.
-	g.connection.Broadcast(NewEffectMessage(g.Yield))
+	g.connection.Broadcast(g.effectMessage())
+}
+
+// expireEffects reverses the modifiers of any effects which have expired.
+func (g *Game) expireEffects() {
+	var active []*ActiveEffect
+	for _, e := range g.effects {
+		if g.tick < e.Expires {
+			active = append(active, e)
+			continue
+		}
+
+		inverse := make(map[CommodityType]float64)
+		for c, m := range e.PriceModifier {
+			inverse[c] = 1 / m
+		}
+		g.Market.ApplyModifier(inverse)
+		for _, c := range g.Market.Types() {
+			if m, ok := e.YieldRateModifier[c]; ok {
+				g.Yield[c] /= m
+			}
+		}
+	}
+
+	if len(active) == len(g.effects) {
+		return
+	}
+	g.effects = active
+
+	// Inform the consumers that the effects are updated, and the prices
+	// have changed back.
+	g.connection.Broadcast(g.effectMessage())
+	g.connection.Broadcast(NewPriceUpdatedMessage(g.Market))
+}
+
+// effectMessage describes the current yield rates, and the effects which are
+// still active along with their remaining time.
+func (g *Game) effectMessage() Message {
+	var active []EffectInfo
+	for _, e := range g.effects {
+		active = append(active, EffectInfo{
+			Name:              e.Name,
+			YieldRateModifier: e.YieldRateModifier,
+			PriceModifier:     e.PriceModifier,
+			Remaining:         int((e.Expires - g.tick) / time.Millisecond),
+		})
+	}
+	return NewEffectMessage(g.Yield, active)
 }
 
 // RecieveMessage is called when a user sends a message to the server.
 func (g *Game) RecieveMessage(user User, message Message) {
+	action := ActionOf(message)
+	if err := CheckPhase(action, g.state.Name()); err != nil {
+		user.Message(NewErrorMessage(message, err))
+		return
+	}
+
 	switch msg := message.(type) {
 	case JoinMessage:
-		user.Message(NewWelcomeMessage(g.name, string(g.state.Name())))
-		user.Message(NewEffectMessage(g.Yield))
+		// Open an account for the new player.
+		g.Ledger.Account(user)
+		user.Message(NewWelcomeMessage(g.name, string(g.state.Name()), g.Config.Commodities))
+		user.Message(g.effectMessage())
+		user.Message(g.Snapshot(user))
+	case ResumeMessage:
+		// Bring the returning player up to date with everything that they
+		// might have missed while they were disconnected.
+		user.Message(NewWelcomeMessage(g.name, string(g.state.Name()), g.Config.Commodities))
+		user.Message(g.effectMessage())
+		user.Message(g.Snapshot(user))
+	case LeaveMessage:
+		g.Ledger.Close(user)
+		g.connection.Broadcast(NewPlayerLeftMessage(user.Name()))
 	case SetNameMessage:
 		user.SetName(msg.Name)
 	case ApplyEffectMessage:
@@ -99,6 +298,53 @@ func (g *Game) RecieveMessage(user User, message Message) {
 	g.state.RecieveMessage(user, message)
 }
 
+// Snapshot describes the whole state of the game from the point of view of
+// a user, so that a player who joins or returns mid-game can catch up.
+func (g *Game) Snapshot(user User) Message {
+	snapshot := StateSnapshotMessage{
+		Action:   string(StateSnapshotAction),
+		State:    string(g.state.Name()),
+		Round:    g.Round,
+		Rounds:   g.Config.MaxRounds,
+		Prices:   g.Market.Prices(),
+		Holdings: *g.Ledger.Account(user),
+	}
+
+	if g.nextTimeout != 0 {
+		snapshot.Clock = int((g.nextTimeout - g.tick) / time.Millisecond)
+	}
+
+	if a, ok := g.state.(*AuctionController); ok {
+		info := a.format.Info()
+		info.Format = g.Config.AuctionFormat
+		snapshot.Auction = &info
+	}
+
+	if g.state.Name() == TradeState {
+		for _, t := range g.Market.Types() {
+			snapshot.Books = append(snapshot.Books,
+				NewOrderBookMessage(t, g.Market.Books[t]))
+		}
+	}
+
+	// Players are only ready or not while waiting for the game to start.
+	ready := map[User]bool{}
+	if w, ok := g.state.(*WaitingController); ok {
+		ready = w.ready
+	}
+	for _, u := range g.Ledger.Users() {
+		snapshot.Players = append(snapshot.Players, PlayerInfo{
+			Name:  u.Name(),
+			Ready: ready[u],
+		})
+	}
+	sort.Slice(snapshot.Players, func(i, j int) bool {
+		return snapshot.Players[i].Name < snapshot.Players[j].Name
+	})
+
+	return snapshot
+}
+
 // ChangeState can be called by the state to transition to a new state.
 func (g *Game) ChangeState(newState GameState) {
 	g.state.End()
@@ -108,6 +354,10 @@ func (g *Game) ChangeState(newState GameState) {
 	// Clean up any timers that are currently running
 	g.nextTimeout = 0
 
+	if newState == ProductionState {
+		g.beginRound()
+	}
+
 	g.connection.Broadcast(NewGameStateChangedMessage(newState))
 	g.state = NewStateController(g, newState)
 	g.state.Begin()
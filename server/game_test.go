@@ -3,6 +3,7 @@ package main
 import (
 	"encoding/json"
 	"math/rand"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 
@@ -44,6 +45,27 @@ func (u *TestUser) Message(message Message) error {
 	return nil
 }
 
+// testCards is a small catalogue of cards used to make auctions
+// deterministic in tests.
+var testCards = []Card{
+	{Name: "Dud"},
+	{
+		Name:          "Tomato Tax",
+		PriceModifier: map[CommodityType]float64{Tomato: 0.5},
+	},
+	{
+		Name:              "Corn Boom",
+		Cost:              5,
+		YieldRateModifier: map[CommodityType]float64{Corn: 2.00},
+	},
+}
+
+// seeded returns a source of randomness which always gives the same numbers,
+// so that decks dealt from it are the same every time.
+func seeded() *rand.Rand {
+	return rand.New(rand.NewSource(1))
+}
+
 func CompareBroadcastLog(got, want TestConnection) string {
 	return cmp.Diff(got.broadcastLog, want.broadcastLog)
 }
@@ -54,7 +76,7 @@ func CompareMessageLog(got, want *TestUser) string {
 
 func TestChangeState(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
+	game := NewGame("g", &connection, DefaultGameConfig())
 	game.ChangeState(TradeState)
 
 	expected := TestConnection{}
@@ -72,16 +94,16 @@ func TestChangeState(t *testing.T) {
 }
 
 func TestAuctionStart(t *testing.T) {
-	// Need to set the random seed to force deterministic behavior.
-	rand.Seed(1)
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Deck = NewDeck(testCards, seeded())
 	game.ChangeState(AuctionState)
 
-	rand.Seed(1)
+	deck := NewDeck(testCards, seeded())
+	card, _ := deck.Draw()
 	expected := TestConnection{}
 	expected.Broadcast(NewGameStateChangedMessage(AuctionState))
-	expected.Broadcast(NewAuctionSeedMessage(rand.Int()))
+	expected.Broadcast(NewAuctionCardMessage(card))
 	expected.Broadcast(NewSetClockMessage(AuctionBidTime))
 
 	if diff := CompareBroadcastLog(connection, expected); diff != "" {
@@ -95,8 +117,8 @@ func TestAuctionStart(t *testing.T) {
 
 func TestReadyMechanism(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
-	game.MinPlayers = 2
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Config.MinPlayers = 2
 
 	userA := &TestUser{}
 	userB := &TestUser{}
@@ -127,8 +149,8 @@ func TestReadyMechanism(t *testing.T) {
 // output broadcasts.
 func DontTestPlayerInfoMessage(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
-	game.MinPlayers = 2
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Config.MinPlayers = 2
 
 	userA := &TestUser{name: "George"}
 	userB := &TestUser{name: "Paul"}
@@ -162,8 +184,8 @@ func DontTestPlayerInfoMessage(t *testing.T) {
 }
 func TestReadyMechanismWithMorePlayers(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
-	game.MinPlayers = 2
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Config.MinPlayers = 2
 
 	userA := &TestUser{}
 	userB := &TestUser{}
@@ -185,8 +207,8 @@ func TestReadyMechanismWithMorePlayers(t *testing.T) {
 
 func TestReadyMechanismWithLeaver(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
-	game.MinPlayers = 2
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Config.MinPlayers = 2
 
 	userA := &TestUser{}
 	userB := &TestUser{}
@@ -208,10 +230,9 @@ func TestReadyMechanismWithLeaver(t *testing.T) {
 }
 
 func TestAuctionPhases(t *testing.T) {
-	// Need to set the random seed to force deterministic behavior.
-	rand.Seed(1)
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Deck = NewDeck(testCards, seeded())
 	game.ChangeState(AuctionState)
 
 	// Bid on a card.
@@ -227,18 +248,34 @@ func TestAuctionPhases(t *testing.T) {
 	// Wait until the third auction expires with no bids.
 	game.Tick(3*AuctionBidTime + 3)
 
-	rand.Seed(1)
+	deck := NewDeck(testCards, seeded())
+	first, _ := deck.Draw()
+	second, _ := deck.Draw()
+	third, _ := deck.Draw()
+
+	// The winner of the first card has its effects applied.
+	yield := map[CommodityType]float64{
+		"tomato":    1.00,
+		"purple":    1.00,
+		"blueberry": 1.00,
+		"corn":      1.00,
+	}
+	for c, modifier := range first.YieldRateModifier {
+		yield[c] *= modifier
+	}
+
 	expected := TestConnection{}
 	expected.Broadcast(NewGameStateChangedMessage(AuctionState))
-	expected.Broadcast(NewAuctionSeedMessage(rand.Int()))
+	expected.Broadcast(NewAuctionCardMessage(first))
 	expected.Broadcast(NewSetClockMessage(AuctionBidTime))
 
-	expected.Broadcast(NewBidUpdatedMessage(10, user.Name()))
+	expected.Broadcast(NewBidUpdatedMessage(10, user.Name(), ""))
 	expected.Broadcast(NewSetClockMessage(AuctionBidTime))
-	expected.Broadcast(NewAuctionSeedMessage(rand.Int()))
+	expected.Broadcast(NewEffectMessage(yield, nil))
+	expected.Broadcast(NewAuctionCardMessage(second))
 	expected.Broadcast(NewSetClockMessage(AuctionBidTime))
 
-	expected.Broadcast(NewAuctionSeedMessage(rand.Int()))
+	expected.Broadcast(NewAuctionCardMessage(third))
 	expected.Broadcast(NewSetClockMessage(AuctionBidTime))
 
 	expected.Broadcast(NewGameStateChangedMessage(TradeState))
@@ -246,14 +283,14 @@ func TestAuctionPhases(t *testing.T) {
 	expected.Broadcast(NewSetClockMessage(TradingStageTime))
 
 	if diff := CompareBroadcastLog(connection, expected); diff != "" {
-		t.Errorf("Auction bidding: ", diff)
+		t.Errorf("Auction bidding: %v", diff)
 	}
 }
 
 func TestEffectsBroadcast(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
-	game.MinPlayers = 2
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Config.MinPlayers = 2
 
 	yield := map[CommodityType]float64{
 		"tomato":    1.00,
@@ -281,13 +318,417 @@ func TestEffectsBroadcast(t *testing.T) {
 	game.RecieveMessage(userA, NewApplyEffectMessage(yield, rate, 100))
 	game.RecieveMessage(userA, NewApplyEffectMessage(yield, rate, 100))
 
+	effect := EffectInfo{
+		YieldRateModifier: yield,
+		PriceModifier:     rate,
+		Remaining:         100,
+	}
+
 	expected := TestConnection{}
-	expected.Broadcast(NewEffectMessage(yield))
-	expected.Broadcast(NewEffectMessage(yield_squared))
+	expected.Broadcast(NewEffectMessage(yield, []EffectInfo{effect}))
+	expected.Broadcast(NewEffectMessage(yield_squared, []EffectInfo{effect, effect}))
 
 	if diff := CompareBroadcastLog(connection, expected); diff != "" {
 		t.Errorf("Got: %v", connection.broadcastLog)
 		t.Errorf("Want: %v", expected.broadcastLog)
-		t.Errorf("Auction bidding: ", diff)
+		t.Errorf("Auction bidding: %v", diff)
+	}
+}
+
+func TestEffectsExpire(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+
+	yield := map[CommodityType]float64{Corn: 0.50}
+	rate := map[CommodityType]float64{Tomato: 2.00}
+
+	game.ApplyEffects(ApplyEffectMessage{
+		Name:              "Short",
+		YieldRateModifier: yield,
+		PriceModifier:     rate,
+		Timeout:           100,
+	})
+	game.Tick(50 * time.Millisecond)
+	game.ApplyEffects(ApplyEffectMessage{
+		Name:              "Long",
+		YieldRateModifier: yield,
+		Timeout:           1000,
+	})
+
+	// Only the first effect has expired, so its modifiers are reversed.
+	game.Tick(150 * time.Millisecond)
+	if game.Yield[Corn] != 0.50 {
+		t.Errorf("game.Yield[Corn] = %v, want 0.50", game.Yield[Corn])
+	}
+	if game.Market.Modifier[Tomato] != 1.00 {
+		t.Errorf("game.Market.Modifier[Tomato] = %v, want 1.00", game.Market.Modifier[Tomato])
+	}
+
+	want := game.effectMessage()
+	wantInfo := []EffectInfo{{
+		Name:              "Long",
+		YieldRateModifier: yield,
+		Remaining:         900,
+	}}
+	if diff := cmp.Diff(want.(EffectMessage).Active, wantInfo); diff != "" {
+		t.Errorf("Active effects: %v", diff)
+	}
+
+	// Once the second effect expires, everything is back to normal.
+	game.Tick(1050 * time.Millisecond)
+	if game.Yield[Corn] != 1.00 {
+		t.Errorf("game.Yield[Corn] = %v, want 1.00", game.Yield[Corn])
+	}
+	if len(game.effects) != 0 {
+		t.Errorf("game.effects = %v, want none", game.effects)
+	}
+}
+
+func TestEffectsOnMissingCommodities(t *testing.T) {
+	config := DefaultGameConfig()
+	config.Commodities = []CommodityInfo{
+		{ID: "saffron", Name: "Saffron", Value: 10, Demand: 100},
+	}
+	connection := TestConnection{}
+	game := NewGame("g", &connection, config)
+
+	// Cards written for the usual commodities don't affect other games.
+	game.ApplyEffects(ApplyEffectMessage{
+		Name:              "Tomato blight",
+		YieldRateModifier: map[CommodityType]float64{Tomato: 0.5, "saffron": 2},
+		Timeout:           100,
+	})
+	game.Tick(150 * time.Millisecond)
+	want := map[CommodityType]float64{"saffron": 1}
+	if diff := cmp.Diff(want, game.Yield); diff != "" {
+		t.Errorf("game.Yield differs (-want +got):\n%v", diff)
+	}
+}
+
+func TestPermanentEffects(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+
+	game.ApplyEffects(ApplyEffectMessage{
+		YieldRateModifier: map[CommodityType]float64{Corn: 0.50},
+	})
+	game.Tick(time.Hour)
+
+	if game.Yield[Corn] != 0.50 {
+		t.Errorf("game.Yield[Corn] = %v, want 0.50", game.Yield[Corn])
+	}
+	if len(connection.broadcastLog) != 1 {
+		t.Errorf("Expected a single broadcast, got %q", connection.broadcastLog)
+	}
+}
+
+func TestWrongPhase(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+
+	// Bidding isn't allowed while waiting for players.
+	user := &TestUser{}
+	game.RecieveMessage(user, NewBidMessage(1))
+
+	want := &TestUser{}
+	want.Message(ErrorMessage{
+		Action:    string(ErrorAction),
+		Code:      string(WrongPhaseError),
+		Message:   "Can't bid during the waiting phase",
+		Offending: string(BidAction),
+	})
+
+	if diff := CompareMessageLog(user, want); diff != "" {
+		t.Errorf("ErrorMessage: %q, %q, diff: %v",
+			user.messageLog, want.messageLog, diff)
+	}
+}
+
+func TestSnapshotOnJoin(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+
+	paul := &TestUser{name: "Paul"}
+	game.RecieveMessage(paul, NewJoinMessage())
+	game.RecieveMessage(paul, NewReadyMessage(false))
+
+	george := &TestUser{name: "George"}
+	game.RecieveMessage(george, NewJoinMessage())
+
+	got := DecodeLastMessage(t, george).(StateSnapshotMessage)
+	want := StateSnapshotMessage{
+		Action: string(StateSnapshotAction),
+		State:  string(WaitingState),
+		Prices: game.Market.Prices(),
+		Players: []PlayerInfo{
+			{Name: "George", Ready: false},
+			{Name: "Paul", Ready: false},
+		},
+		Holdings: Account{
+			Money:     StartingMoney,
+			Materials: Materials{},
+			Factories: Materials{},
+		},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("StateSnapshotMessage: %v", diff)
+	}
+}
+
+func TestSnapshotDuringAuction(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Deck = NewDeck([]Card{{Name: "Dud"}}, seeded())
+
+	bidder := &TestUser{name: "Bidder"}
+	game.RecieveMessage(bidder, NewJoinMessage())
+	game.ChangeState(AuctionState)
+	game.RecieveMessage(bidder, NewBidMessage(3))
+	game.Tick(AuctionBidTime / 5)
+
+	late := &TestUser{name: "Late"}
+	game.RecieveMessage(late, NewJoinMessage())
+
+	got := DecodeLastMessage(t, late).(StateSnapshotMessage)
+	if got.State != string(AuctionState) {
+		t.Errorf("snapshot.State = %v, want %v", got.State, AuctionState)
+	}
+	wantClock := int((AuctionBidTime - AuctionBidTime/5) / time.Millisecond)
+	if got.Clock != wantClock {
+		t.Errorf("snapshot.Clock = %v, want %v", got.Clock, wantClock)
+	}
+	wantAuction := &AuctionInfo{
+		Format: EnglishAuction, Card: Card{Name: "Dud"}, Bid: 3, Winner: "Bidder"}
+	if diff := cmp.Diff(got.Auction, wantAuction); diff != "" {
+		t.Errorf("snapshot.Auction: %v", diff)
+	}
+}
+
+// DecodeLastMessage decodes the last message that was sent to the user.
+func DecodeLastMessage(t *testing.T, u *TestUser) Message {
+	if len(u.messageLog) == 0 {
+		t.Fatalf("No messages were sent to %q", u.name)
+	}
+	msg, err := DecodeMessage([]byte(u.messageLog[len(u.messageLog)-1]))
+	if err != nil {
+		t.Fatalf("DecodeMessage(...) returned err: %v", err)
+	}
+	return msg
+}
+
+func TestLeaveClosesAccount(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+
+	user := &TestUser{name: "Ringo"}
+	game.RecieveMessage(user, NewJoinMessage())
+	connection.broadcastLog = nil
+	game.RecieveMessage(user, NewLeaveMessage())
+
+	if users := game.Ledger.Users(); len(users) != 0 {
+		t.Errorf("game.Ledger.Users() = %v, want none", users)
+	}
+
+	expected := TestConnection{}
+	expected.Broadcast(NewPlayerLeftMessage("Ringo"))
+	expected.Broadcast(NewPlayerInfoUpdateMessage(nil))
+	if diff := CompareBroadcastLog(connection, expected); diff != "" {
+		t.Errorf("PlayerLeftMessage: %v", diff)
+	}
+}
+
+// playRound runs the game through a whole round, from the production phase
+// to the end of the trading phase.
+func playRound(game *Game) {
+	game.Tick(game.GetTime() + milliseconds(game.Config.ProductionTime) + 1)
+	game.Tick(game.GetTime() + milliseconds(game.Config.TradingTime) + 1)
+}
+
+func TestGameEndsAfterMaxRounds(t *testing.T) {
+	config := DefaultGameConfig()
+	config.NumberOfBids = 0
+	config.MaxRounds = 2
+	connection := TestConnection{}
+	game := NewGame("g", &connection, config)
+	game.ChangeState(ProductionState)
+
+	playRound(game)
+	if got := game.state.Name(); got != ProductionState {
+		t.Fatalf("State after the first round = %v, want %v", got, ProductionState)
+	}
+	if game.Round != 2 {
+		t.Errorf("game.Round = %v, want 2", game.Round)
+	}
+
+	playRound(game)
+	if got := game.state.Name(); got != GameOverState {
+		t.Fatalf("State after the last round = %v, want %v", got, GameOverState)
+	}
+	var over GameOverMessage
+	json.Unmarshal([]byte(connection.broadcastLog[len(connection.broadcastLog)-1]), &over)
+	if over.Action != string(GameOverAction) || over.Reason != MaxRoundsReason {
+		t.Errorf("Last broadcast = %+v, want a game over for %v", over, MaxRoundsReason)
+	}
+
+	// Nothing more happens once the game is over.
+	game.Tick(game.GetTime() + time.Hour)
+	if got := game.state.Name(); got != GameOverState {
+		t.Errorf("State after the game was over = %v, want %v", got, GameOverState)
+	}
+}
+
+func TestGameEndsAtTargetWealth(t *testing.T) {
+	config := DefaultGameConfig()
+	config.NumberOfBids = 0
+	config.TargetWealth = 100
+	connection := TestConnection{}
+	game := NewGame("g", &connection, config)
+
+	poor := &TestUser{name: "Paul"}
+	rich := &TestUser{name: "Ringo"}
+	game.RecieveMessage(poor, NewJoinMessage())
+	game.RecieveMessage(rich, NewJoinMessage())
+	game.ChangeState(ProductionState)
+
+	playRound(game)
+	if got := game.state.Name(); got != ProductionState {
+		t.Fatalf("State when nobody is rich = %v, want %v", got, ProductionState)
+	}
+
+	game.Ledger.Credit(rich, 100)
+	playRound(game)
+	if got := game.state.Name(); got != GameOverState {
+		t.Fatalf("State when Ringo is rich = %v, want %v", got, GameOverState)
+	}
+	var over GameOverMessage
+	json.Unmarshal([]byte(connection.broadcastLog[len(connection.broadcastLog)-1]), &over)
+	if over.Winner != "Ringo" || over.Reason != TargetWealthReason {
+		t.Errorf("Last broadcast = %+v, want Ringo to win", over)
+	}
+
+	// Players who join late find out who won.
+	late := &TestUser{name: "George"}
+	game.RecieveMessage(late, NewJoinMessage())
+	if over, ok := DecodeLastMessage(t, late).(GameOverMessage); !ok || over.Winner != "Ringo" {
+		t.Errorf("Last message to George = %+v, want the game over", over)
+	}
+}
+
+func TestTargetWealthCountsOrders(t *testing.T) {
+	config := DefaultGameConfig()
+	config.NumberOfBids = 0
+	config.TargetWealth = StartingMoney
+	connection := TestConnection{}
+	game := NewGame("g", &connection, config)
+
+	// The money held for a bid which is still waiting at the end of the
+	// round is given back before the end of the game is checked.
+	user := &TestUser{name: "Ringo"}
+	game.RecieveMessage(user, NewJoinMessage())
+	game.ChangeState(ProductionState)
+	game.Tick(game.GetTime() + milliseconds(config.ProductionTime) + 1)
+	game.RecieveMessage(user, NewPlaceOrderMessage(Corn, BidSide, 5, 2))
+	if _, ok := DecodeLastMessage(t, user).(OrderPlacedMessage); !ok {
+		t.Fatalf("Last message to Ringo = %v, want the order placed", user.messageLog)
+	}
+
+	game.Tick(game.GetTime() + milliseconds(config.TradingTime) + 1)
+	if got := game.state.Name(); got != GameOverState {
+		t.Errorf("State when Ringo's money is in a bid = %v, want %v", got, GameOverState)
+	}
+}
+
+func TestGameEndsAtTimeLimit(t *testing.T) {
+	config := DefaultGameConfig()
+	config.TimeLimit = 15000
+	connection := TestConnection{}
+	game := NewGame("g", &connection, config)
+
+	// The clock only starts once the game has begun.
+	game.Tick(time.Minute)
+	game.ChangeState(ProductionState)
+	game.Tick(time.Minute + 14*time.Second)
+	if got := game.state.Name(); got == GameOverState {
+		t.Fatalf("Game ended before the time limit")
+	}
+
+	game.Tick(time.Minute + 15*time.Second)
+	if got := game.state.Name(); got != GameOverState {
+		t.Errorf("State after the time limit = %v, want %v", got, GameOverState)
+	}
+}
+
+func TestStandings(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+
+	john := &TestUser{name: "John"}
+	paul := &TestUser{name: "Paul"}
+	ringo := &TestUser{name: "Ringo"}
+	for _, u := range []*TestUser{john, paul, ringo} {
+		game.RecieveMessage(u, NewJoinMessage())
+	}
+	// Materials count towards net worth at the market price.
+	game.Ledger.Deposit(john, Materials{Tomato: 2})
+	price := game.Market.Prices()[Tomato]
+	game.Ledger.Credit(ringo, 2*price)
+
+	want := []Standing{
+		{Rank: 1, Name: "John", NetWorth: StartingMoney + 2*price, Money: StartingMoney, Materials: Materials{Tomato: 2}},
+		{Rank: 1, Name: "Ringo", NetWorth: StartingMoney + 2*price, Money: StartingMoney + 2*price, Materials: Materials{}},
+		{Rank: 3, Name: "Paul", NetWorth: StartingMoney, Money: StartingMoney, Materials: Materials{}},
+	}
+	if diff := cmp.Diff(want, game.Standings()); diff != "" {
+		t.Errorf("game.Standings() differs (-want +got):\n%v", diff)
+	}
+}
+
+func TestRoundSummary(t *testing.T) {
+	config := DefaultGameConfig()
+	config.NumberOfBids = 0
+	connection := TestConnection{}
+	game := NewGame("g", &connection, config)
+
+	john := &TestUser{name: "John"}
+	paul := &TestUser{name: "Paul"}
+	game.RecieveMessage(john, NewJoinMessage())
+	game.RecieveMessage(paul, NewJoinMessage())
+	game.ChangeState(ProductionState)
+	game.Tick(game.GetTime() + milliseconds(config.ProductionTime) + 1)
+
+	game.Ledger.Deposit(john, Materials{Tomato: 2, Corn: 1})
+	game.Ledger.Deposit(paul, Materials{Blueberry: 1})
+	start := game.Market.Prices()
+	game.RecieveMessage(john, NewSellMessage(Tomato, 2))
+	game.RecieveMessage(john, NewTradeMessage(Materials{Corn: 1}, 0))
+	game.RecieveMessage(paul, NewTradeMessage(Materials{Blueberry: 1}, 0))
+	earnings := game.Ledger.Account(john).Money - StartingMoney
+	end := game.Market.Prices()
+
+	connection.broadcastLog = nil
+	game.Tick(game.GetTime() + milliseconds(config.TradingTime) + 1)
+
+	var summary RoundSummaryMessage
+	json.Unmarshal([]byte(connection.broadcastLog[0]), &summary)
+	want := RoundSummaryMessage{
+		Action: string(RoundSummaryAction),
+		Round:  1,
+		Players: []RoundPlayerSummary{
+			{Name: "John", Earnings: earnings, Purchases: []AuctionPurchase{}, Trades: 1},
+			{Name: "Paul", Purchases: []AuctionPurchase{}, Trades: 1},
+		},
+		Prices: map[CommodityType]PriceMovement{},
+	}
+	for t, p := range end {
+		want.Prices[t] = PriceMovement{Start: start[t], End: p}
+	}
+	if diff := cmp.Diff(want, summary); diff != "" {
+		t.Errorf("Round summary differs (-want +got):\n%v", diff)
+	}
+	if want.Prices[Tomato].End >= want.Prices[Tomato].Start {
+		t.Errorf("Price of tomatoes didn't fall after selling them")
+	}
+	if game.Round != 2 {
+		t.Errorf("game.Round = %v, want 2", game.Round)
 	}
 }
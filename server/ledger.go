@@ -0,0 +1,185 @@
+package main
+
+import (
+	"math"
+)
+
+const (
+	// StartingMoney is the amount of money each player holds when they
+	// first join the game.
+	StartingMoney float64 = 25
+)
+
+// Materials is a quantity of each commodity, e.g. the contents of a player's
+// inventory or the goods offered in a trade.
+type Materials map[CommodityType]int64
+
+// An Offer is what one side of a trade gives to the other: some materials,
+// and optionally some money.
+type Offer struct {
+	Materials Materials `json:"materials"`
+	Money     float64   `json:"money,omitempty"`
+}
+
+// Validate returns an error if the offer holds a negative or nonsensical
+// amount of anything.
+func (o Offer) Validate() error {
+	for t, q := range o.Materials {
+		if q < 0 {
+			return NewGameError(InvalidRequestError,
+				"Invalid quantity of %v: %v", t, q)
+		}
+	}
+	if o.Money < 0 || math.IsNaN(o.Money) || math.IsInf(o.Money, 0) {
+		return NewGameError(InvalidRequestError,
+			"Invalid amount of money: %v", o.Money)
+	}
+	return nil
+}
+
+// Account holds the money, materials and factories owned by a single player.
+type Account struct {
+	Money     float64   `json:"money"`
+	Materials Materials `json:"materials"`
+	Factories Materials `json:"factories"`
+}
+
+// Ledger keeps the books for every player in a game. The server is the
+// authority on how much each player holds, so every sale, bid and trade is
+// checked against the ledger before it is allowed to go through.
+type Ledger struct {
+	accounts map[User]*Account
+}
+
+// NewLedger constructs an empty ledger.
+func NewLedger() *Ledger {
+	return &Ledger{
+		accounts: make(map[User]*Account),
+	}
+}
+
+// Account returns the account belonging to a user, opening a new one with
+// the starting balance if the user doesn't have one yet.
+func (l *Ledger) Account(u User) *Account {
+	a, ok := l.accounts[u]
+	if !ok {
+		a = &Account{
+			Money:     StartingMoney,
+			Materials: Materials{},
+			Factories: Materials{},
+		}
+		l.accounts[u] = a
+	}
+	return a
+}
+
+// Close removes a user's account from the ledger.
+func (l *Ledger) Close(u User) {
+	delete(l.accounts, u)
+}
+
+// Users returns every user that holds an account.
+func (l *Ledger) Users() []User {
+	var users []User
+	for u := range l.accounts {
+		users = append(users, u)
+	}
+	return users
+}
+
+// Credit adds money to a user's account.
+func (l *Ledger) Credit(u User, amount float64) {
+	l.Account(u).Money += amount
+}
+
+// CanAfford returns true if the user holds at least the given amount of money.
+func (l *Ledger) CanAfford(u User, amount float64) bool {
+	return l.Account(u).Money >= amount
+}
+
+// Debit removes money from a user's account. It fails without changing the
+// account if the user can't afford it.
+func (l *Ledger) Debit(u User, amount float64) error {
+	if !l.CanAfford(u, amount) {
+		return NewGameError(InsufficientFundsError,
+			"Insufficient funds: need %v, have %v",
+			amount, l.Account(u).Money)
+	}
+	l.Account(u).Money -= amount
+	return nil
+}
+
+// Has returns an error if the user doesn't hold all of the given materials.
+func (l *Ledger) Has(u User, m Materials) error {
+	a := l.Account(u)
+	for t, q := range m {
+		if q < 0 {
+			return NewGameError(InvalidRequestError,
+				"Invalid quantity of %v: %v", t, q)
+		}
+		if a.Materials[t] < q {
+			return NewGameError(InsufficientMaterialsError,
+				"Not enough %v: need %v, have %v",
+				t, q, a.Materials[t])
+		}
+	}
+	return nil
+}
+
+// Deposit adds materials to a user's account.
+func (l *Ledger) Deposit(u User, m Materials) {
+	a := l.Account(u)
+	for t, q := range m {
+		a.Materials[t] += q
+	}
+}
+
+// Withdraw removes materials from a user's account. It fails without changing
+// the account if the user doesn't hold all of them.
+func (l *Ledger) Withdraw(u User, m Materials) error {
+	if err := l.Has(u, m); err != nil {
+		return err
+	}
+	a := l.Account(u)
+	for t, q := range m {
+		a.Materials[t] -= q
+	}
+	return nil
+}
+
+// CanGive returns an error if the offer is invalid, or if the user doesn't
+// hold everything in it.
+func (l *Ledger) CanGive(u User, o Offer) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	if err := l.Has(u, o.Materials); err != nil {
+		return err
+	}
+	if !l.CanAfford(u, o.Money) {
+		return NewGameError(InsufficientFundsError,
+			"Insufficient funds: need %v, have %v",
+			o.Money, l.Account(u).Money)
+	}
+	return nil
+}
+
+// Exchange swaps offers between two users, giving a's offer to b and b's
+// offer to a. Either both sides of the exchange happen, or neither.
+func (l *Ledger) Exchange(a, b User, fromA, fromB Offer) error {
+	if err := l.CanGive(a, fromA); err != nil {
+		return err
+	}
+	if err := l.CanGive(b, fromB); err != nil {
+		return err
+	}
+	l.Withdraw(a, fromA.Materials)
+	l.Withdraw(b, fromB.Materials)
+	l.Debit(a, fromA.Money)
+	l.Debit(b, fromB.Money)
+	l.Deposit(a, fromB.Materials)
+	l.Deposit(b, fromA.Materials)
+	l.Credit(a, fromB.Money)
+	l.Credit(b, fromA.Money)
+	return nil
+}
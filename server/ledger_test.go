@@ -0,0 +1,115 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLedgerDebit(t *testing.T) {
+	l := NewLedger()
+	u := &TestUser{}
+
+	if err := l.Debit(u, StartingMoney+1); err == nil {
+		t.Errorf("l.Debit(u, %v) = nil, want error", StartingMoney+1)
+	}
+	if money := l.Account(u).Money; money != StartingMoney {
+		t.Errorf("money = %v, want %v", money, StartingMoney)
+	}
+
+	if err := l.Debit(u, StartingMoney); err != nil {
+		t.Errorf("l.Debit(u, %v) returned err: %v", StartingMoney, err)
+	}
+	if money := l.Account(u).Money; money != 0 {
+		t.Errorf("money = %v, want 0", money)
+	}
+}
+
+func TestLedgerWithdraw(t *testing.T) {
+	l := NewLedger()
+	u := &TestUser{}
+	l.Deposit(u, Materials{Tomato: 3, Corn: 1})
+
+	// Withdrawing more than is held leaves the account untouched.
+	if err := l.Withdraw(u, Materials{Tomato: 1, Corn: 2}); err == nil {
+		t.Errorf("l.Withdraw(...) = nil, want error")
+	}
+	if err := l.Withdraw(u, Materials{Tomato: -1}); err == nil {
+		t.Errorf("l.Withdraw(...) = nil, want error for negative quantity")
+	}
+
+	if err := l.Withdraw(u, Materials{Tomato: 2, Corn: 1}); err != nil {
+		t.Errorf("l.Withdraw(...) returned err: %v", err)
+	}
+	got := l.Account(u).Materials
+	if got[Tomato] != 1 || got[Corn] != 0 {
+		t.Errorf("materials = %v, want 1 tomato and 0 corn", got)
+	}
+}
+
+func TestLedgerExchangeIsAtomic(t *testing.T) {
+	l := NewLedger()
+	a := &TestUser{}
+	b := &TestUser{}
+	l.Deposit(a, Materials{Tomato: 1})
+
+	// b doesn't hold any corn, so nothing should change hands.
+	fromA := Offer{Materials: Materials{Tomato: 1}}
+	fromB := Offer{Materials: Materials{Corn: 1}}
+	if err := l.Exchange(a, b, fromA, fromB); err == nil {
+		t.Errorf("l.Exchange(...) = nil, want error")
+	}
+	if got := l.Account(a).Materials[Tomato]; got != 1 {
+		t.Errorf("a's tomatoes = %v, want 1", got)
+	}
+	if got := l.Account(b).Materials[Tomato]; got != 0 {
+		t.Errorf("b's tomatoes = %v, want 0", got)
+	}
+}
+
+func TestLedgerExchangeWithMoney(t *testing.T) {
+	l := NewLedger()
+	a := &TestUser{}
+	b := &TestUser{}
+	l.Deposit(a, Materials{Tomato: 2})
+
+	// b buys a's tomatoes for cash.
+	fromA := Offer{Materials: Materials{Tomato: 2}}
+	fromB := Offer{Money: 10}
+	if err := l.Exchange(a, b, fromA, fromB); err != nil {
+		t.Fatalf("l.Exchange(...) returned err: %v", err)
+	}
+	if got := l.Account(a).Money; got != StartingMoney+10 {
+		t.Errorf("a's money = %v, want %v", got, StartingMoney+10)
+	}
+	if got := l.Account(b).Money; got != StartingMoney-10 {
+		t.Errorf("b's money = %v, want %v", got, StartingMoney-10)
+	}
+	if got := l.Account(b).Materials[Tomato]; got != 2 {
+		t.Errorf("b's tomatoes = %v, want 2", got)
+	}
+
+	// b can't pay more than they hold.
+	fromB = Offer{Money: StartingMoney}
+	if err := l.Exchange(a, b, Offer{}, fromB); ErrorCodeOf(err) != InsufficientFundsError {
+		t.Errorf("l.Exchange(...) = %v, want %v", err, InsufficientFundsError)
+	}
+}
+
+func TestOfferValidate(t *testing.T) {
+	valid := Offer{Materials: Materials{Tomato: 2, Corn: 0}, Money: 1.5}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("%+v.Validate() returned err: %v", valid, err)
+	}
+
+	invalid := []Offer{
+		{Materials: Materials{Tomato: -1}},
+		{Money: -1},
+		{Money: math.NaN()},
+		{Money: math.Inf(1)},
+	}
+	for _, o := range invalid {
+		if err := o.Validate(); ErrorCodeOf(err) != InvalidRequestError {
+			t.Errorf("%+v.Validate() = %v, want %v", o, err, InvalidRequestError)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// GameInfo describes a game in progress, so that players can pick one to
+// join from the lobby.
+type GameInfo struct {
+	Name        string        `json:"name"`
+	State       string        `json:"state"`
+	PlayerCount int           `json:"player_count"`
+	Config      GameConfig    `json:"config"`
+	Players     []LobbyPlayer `json:"players,omitempty"`
+}
+
+// LobbyPlayer describes a player seated in a game.
+type LobbyPlayer struct {
+	Name      string `json:"name"`
+	Connected bool   `json:"connected"`
+}
+
+// CreateGameRequest is the body of a POST to /games. Every field is optional,
+// including each of the rules in the config.
+type CreateGameRequest struct {
+	Name   string     `json:"name"`
+	Config GameConfig `json:"config"`
+}
+
+// The /games URL lists the games which are waiting for players on a GET, and
+// starts a new game on a POST. The /games/{name} URL describes a single game.
+func games(w http.ResponseWriter, r *http.Request) {
+	name := strings.Trim(strings.TrimPrefix(r.URL.Path, "/games"), "/")
+
+	switch {
+	case name == "" && r.Method == http.MethodGet:
+		listGames(w, r)
+	case name == "" && r.Method == http.MethodPost:
+		createGame(w, r)
+	case name != "" && r.Method == http.MethodGet:
+		describeGame(w, r, name)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// AllGames is the value of the state parameter which lists every game.
+const AllGames = "all"
+
+// listGames lists the games in the state given by the state parameter. By
+// default that's the games which are still waiting for players, since those
+// are the ones worth joining.
+func listGames(w http.ResponseWriter, r *http.Request) {
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = string(WaitingState)
+	}
+
+	list := []GameInfo{}
+	for _, game := range Games.Games() {
+		info, ok := game.Info()
+		if !ok {
+			// The game ended while we were looking at it.
+			continue
+		}
+		if state != AllGames && info.State != state {
+			continue
+		}
+		// The list only gives a summary of each game.
+		info.Players = nil
+		list = append(list, info)
+	}
+	writeJSON(w, http.StatusOK, list)
+}
+
+func createGame(w http.ResponseWriter, r *http.Request) {
+	req := CreateGameRequest{Config: DefaultGameConfig()}
+	if r.ContentLength != 0 {
+		d := json.NewDecoder(r.Body)
+		d.DisallowUnknownFields()
+		if err := d.Decode(&req); err != nil {
+			http.Error(w, "Unable to decode request: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if err := req.Config.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var game *GameServer
+	var err error
+	if req.Name != "" {
+		game, err = Games.Create(req.Name, req.Config)
+	} else {
+		game, err = Games.CreateWithRandomName(req.Config)
+	}
+	if err == ErrGameExists {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+
+	info, ok := game.Info()
+	if !ok {
+		http.Error(w, "The game was shut down", http.StatusServiceUnavailable)
+		return
+	}
+	writeJSON(w, http.StatusCreated, info)
+}
+
+func describeGame(w http.ResponseWriter, r *http.Request, name string) {
+	game, ok := Games.Lookup(name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	info, ok := game.Info()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// writeJSON sends a JSON response with the given status code.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Unable to write response: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// lobbyRequest sends a request to the lobby API, and decodes the response.
+func lobbyRequest(t *testing.T, method, path, body string, response interface{}) int {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	games(w, r)
+	if response != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), response); err != nil {
+			t.Fatalf("Unable to decode response to %v %v: %v", method, path, err)
+		}
+	}
+	return w.Code
+}
+
+func TestLobby(t *testing.T) {
+	Games = NewGameRegistry(context.Background(), 2)
+	defer Games.Shutdown()
+
+	var created GameInfo
+	body := `{"name": "farm", "config": {"min_players": 3}}`
+	if code := lobbyRequest(t, "POST", "/games", body, &created); code != http.StatusCreated {
+		t.Fatalf("POST /games returned %v, want %v", code, http.StatusCreated)
+	}
+	config := DefaultGameConfig()
+	config.MinPlayers = 3
+	// The commodities aren't part of the config that the lobby describes.
+	config.Commodities = nil
+	want := GameInfo{Name: "farm", State: string(WaitingState), Config: config}
+	if diff := cmp.Diff(want, created); diff != "" {
+		t.Errorf("Created game differs (-want +got):\n%v", diff)
+	}
+
+	body = `{"name": "bad", "config": {"min_players": 0}}`
+	if code := lobbyRequest(t, "POST", "/games", body, nil); code != http.StatusBadRequest {
+		t.Errorf("POST /games with invalid rules returned %v, want %v", code, http.StatusBadRequest)
+	}
+	if code := lobbyRequest(t, "POST", "/games", `{"name": "farm"}`, nil); code != http.StatusConflict {
+		t.Errorf("POST /games for an existing game returned %v, want %v", code, http.StatusConflict)
+	}
+
+	// Games get a random name if they aren't given one.
+	if code := lobbyRequest(t, "POST", "/games", "", &created); code != http.StatusCreated {
+		t.Fatalf("POST /games returned %v, want %v", code, http.StatusCreated)
+	}
+	if created.Name == "" {
+		t.Errorf("POST /games created a game without a name")
+	}
+	if code := lobbyRequest(t, "POST", "/games", "", nil); code != http.StatusServiceUnavailable {
+		t.Errorf("POST /games with too many games returned %v, want %v", code, http.StatusServiceUnavailable)
+	}
+
+	var list []GameInfo
+	if code := lobbyRequest(t, "GET", "/games", "", &list); code != http.StatusOK {
+		t.Fatalf("GET /games returned %v, want %v", code, http.StatusOK)
+	}
+	if len(list) != 2 {
+		t.Errorf("GET /games listed %v games, want 2", len(list))
+	}
+
+	// Once a game has started, it's no longer listed by default.
+	server := httptest.NewServer(http.HandlerFunc(join))
+	defer server.Close()
+	conn := dialGame(t, server, created.Name, "p")
+	defer conn.Close()
+	conn.WriteJSON(NewReadyMessage(true))
+	awaitMessage(t, conn, GameStateChangedAction)
+	if code := lobbyRequest(t, "GET", "/games", "", &list); code != http.StatusOK {
+		t.Fatalf("GET /games returned %v, want %v", code, http.StatusOK)
+	}
+	if len(list) != 1 || list[0].Name != "farm" {
+		t.Errorf("GET /games listed %v, want only farm", list)
+	}
+	lobbyRequest(t, "GET", "/games?state=production", "", &list)
+	if len(list) != 1 || list[0].Name != created.Name {
+		t.Errorf("GET /games?state=production listed %v, want only %v", list, created.Name)
+	}
+	lobbyRequest(t, "GET", "/games?state=all", "", &list)
+	if len(list) != 2 {
+		t.Errorf("GET /games?state=all listed %v games, want 2", len(list))
+	}
+
+	var info GameInfo
+	if code := lobbyRequest(t, "GET", "/games/farm", "", &info); code != http.StatusOK {
+		t.Fatalf("GET /games/farm returned %v, want %v", code, http.StatusOK)
+	}
+	if info.Name != "farm" {
+		t.Errorf("GET /games/farm described %q", info.Name)
+	}
+	if code := lobbyRequest(t, "GET", "/games/nowhere", "", nil); code != http.StatusNotFound {
+		t.Errorf("GET /games/nowhere returned %v, want %v", code, http.StatusNotFound)
+	}
+}
@@ -1,17 +1,32 @@
 package main
 
 import (
+	"context"
+	"crypto/subtle"
 	"flag"
 	"fmt"
 	"github.com/gorilla/websocket"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const (
+	// ShutdownTimeout is how long the server waits for HTTP requests to
+	// finish when it's asked to shut down.
+	ShutdownTimeout time.Duration = 5 * time.Second
 )
 
 var (
-	// AllGames is a map of all the games currently in progress.
-	// The key is the name of the game.
-	AllGames map[string]*GameServer
+	// Games keeps track of all the games currently in progress.
+	Games *GameRegistry
+
+	// AdminToken is the secret which players must provide when joining in
+	// order to send admin-only actions. If it's empty, nobody is an admin.
+	AdminToken string
 )
 
 var upgrader = websocket.Upgrader{
@@ -22,7 +37,12 @@ var upgrader = websocket.Upgrader{
 
 // The /join URL takes two parameters, game, and name. The game
 // argument is optional. If specified, we'll try to join a game
-// with that name.
+// with that name, otherwise a new game with a random name is
+// started. An optional config parameter holds the rules, as a
+// JSON GameConfig, for a game which is started by joining it.
+// An optional admin parameter grants admin
+// privileges if it matches the AdminToken, and an optional
+// session parameter resumes a seat which was dropped.
 func join(w http.ResponseWriter, r *http.Request) {
 	params := r.URL.Query()
 	n, ok := params["name"]
@@ -31,12 +51,29 @@ func join(w http.ResponseWriter, r *http.Request) {
 		name = n[0]
 	}
 
-	t, ok := params["game"]
-	var target string
-	if ok {
-		target = t[0]
+	// Find the game before upgrading the connection, so that a plain HTTP
+	// error can be returned if there are too many games. Players who don't
+	// name a game get a new one, whose name they're told when they join.
+	config := DefaultGameConfig()
+	if c := params.Get("config"); c != "" {
+		var err error
+		if config, err = ParseGameConfig(c); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var game *GameServer
+	var err error
+	if t, ok := params["game"]; ok {
+		game, err = Games.LookupOrCreate(t[0], config)
 	} else {
-		target = GenerateGameName()
+		game, err = Games.CreateWithRandomName(config)
+	}
+	if err != nil {
+		log.Println(err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
 	}
 
 	conn, err := upgrader.Upgrade(w, r, nil)
@@ -45,27 +82,64 @@ func join(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	player := Player{
-		name:       name,
-		Connection: conn,
+	player := NewPlayer(name, params.Get("session"), isAdmin(params.Get("admin")), conn)
+	if !game.AddPlayer(player) {
+		// The game was torn down in the meantime.
+		log.Printf("Game %q stopped before %q could join", game.Name(), name)
+		conn.Close()
 	}
+}
 
-	game, ok := AllGames[target]
-	if !ok {
-		// The game doesn't exist, create it.
-		game = NewGameServer(target)
-		AllGames[target] = game
+// isAdmin returns true if the token grants admin privileges.
+func isAdmin(token string) bool {
+	if AdminToken == "" {
+		return false
 	}
-	game.AddPlayer(player)
+	return subtle.ConstantTimeCompare([]byte(token), []byte(AdminToken)) == 1
 }
 
 func main() {
 	port := flag.String("port", "8080", "the port to use to serve")
+	cards := flag.String("cards", "data/cards.json", "the catalogue of auction cards")
+	commodities := flag.String("commodities", "data/commodities.json", "the catalogue of commodities")
+	flag.StringVar(&AdminToken, "admin_token", "", "the token which grants admin privileges")
+	maxGames := flag.Int("max_games", DefaultMaxGames, "the maximum number of games in progress at once")
 	flag.Parse()
 
-	AllGames = make(map[string]*GameServer)
+	var err error
+	AllCards, err = LoadCards(*cards)
+	if err != nil {
+		log.Fatal(err)
+	}
+	AllCommodities, err = LoadCommodities(*commodities)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	Games = NewGameRegistry(context.Background(), *maxGames)
 	http.HandleFunc("/join", join)
+	http.HandleFunc("/games", games)
+	http.HandleFunc("/games/", games)
 	http.HandleFunc("/", http.FileServer(http.Dir("./web")).ServeHTTP)
-	log.Fatal(http.ListenAndServe(fmt.Sprintf(":%s", *port), nil))
 
+	server := &http.Server{Addr: fmt.Sprintf(":%s", *port)}
+	go func() {
+		if err := server.ListenAndServe(); err != http.ErrServerClosed {
+			log.Fatal(err)
+		}
+	}()
+
+	// On SIGTERM, stop accepting new players, then let everybody know that
+	// their games are over before exiting.
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	sig := <-signals
+	log.Printf("Received %v, shutting down", sig)
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("HTTP server shutdown failed: %v", err)
+	}
+	Games.Shutdown()
 }
@@ -1,12 +1,23 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"math"
+	"math/rand"
+)
+
+const (
+	// MaxDemandDrift bounds how far demand can wander from where it started:
+	// it stays between 1/MaxDemandDrift and MaxDemandDrift times the
+	// starting demand.
+	MaxDemandDrift float64 = 2
 )
 
 type CommodityType string
 
+// The built-in commodities.
 const (
 	Tomato    CommodityType = "tomato"
 	Blueberry CommodityType = "blueberry"
@@ -14,57 +25,232 @@ const (
 	Purple    CommodityType = "purple"
 )
 
-var AllCommodities []CommodityType = []CommodityType{Tomato, Blueberry, Corn, Purple}
+// CommodityInfo describes a commodity which can be grown and traded, and the
+// state of its market when a game begins.
+type CommodityInfo struct {
+	ID     CommodityType `json:"id"`
+	Name   string        `json:"name"`
+	Value  float64       `json:"value"`
+	Demand float64       `json:"demand"`
+	Supply int64         `json:"supply"`
+}
+
+var (
+	// AllCommodities is the catalogue of commodities which games are played
+	// with by default. The built-in commodities can be replaced by loading a
+	// data file when the server starts.
+	AllCommodities = []CommodityInfo{
+		{ID: Tomato, Name: "Tomato", Value: 100, Demand: 100, Supply: 100},
+		{ID: Blueberry, Name: "Blueberry", Value: 100, Demand: 100, Supply: 100},
+		{ID: Corn, Name: "Corn", Value: 100, Demand: 100, Supply: 100},
+		{ID: Purple, Name: "Purple", Value: 100, Demand: 100, Supply: 100},
+	}
+)
+
+// LoadCommodities reads a catalogue of commodities from a JSON file
+// containing a list of commodities.
+func LoadCommodities(path string) ([]CommodityInfo, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var commodities []CommodityInfo
+	if err := json.Unmarshal(data, &commodities); err != nil {
+		return nil, fmt.Errorf("Unable to decode commodities in %v: %v", path, err)
+	}
+	if err := ValidateCommodities(commodities); err != nil {
+		return nil, fmt.Errorf("Invalid commodities in %v: %v", path, err)
+	}
+	return commodities, nil
+}
+
+// ValidateCommodities returns an error unless the catalogue holds at least
+// one commodity, each with a unique ID and a market that makes sense.
+func ValidateCommodities(commodities []CommodityInfo) error {
+	if len(commodities) == 0 {
+		return NewGameError(InvalidRequestError, "There are no commodities")
+	}
+	seen := make(map[CommodityType]bool)
+	for _, c := range commodities {
+		if c.ID == "" {
+			return NewGameError(InvalidRequestError, "Commodity %q has no ID", c.Name)
+		}
+		if seen[c.ID] {
+			return NewGameError(InvalidRequestError, "Duplicate commodity: %v", c.ID)
+		}
+		seen[c.ID] = true
+		if c.Value <= 0 || c.Demand <= 0 || c.Supply < 0 {
+			return NewGameError(InvalidRequestError, "Invalid market for %v", c.ID)
+		}
+	}
+	return nil
+}
 
 type Market struct {
 	Commodities map[CommodityType]*Commodity
 	Modifier    map[CommodityType]float64
+	// Books holds the orders which players have placed to trade each
+	// commodity with each other.
+	Books map[CommodityType]*OrderBook
+	// types lists the commodities in the order of the catalogue.
+	types       []CommodityType
+	nextOrderID int64
 }
 
-func NewMarket() Market {
+// NewMarket constructs a market for a catalogue of commodities, each of which
+// starts out with the supply, value and demand given in the catalogue.
+func NewMarket(commodities []CommodityInfo) Market {
 	m := Market{
 		Commodities: make(map[CommodityType]*Commodity),
 		Modifier:    make(map[CommodityType]float64),
+		Books:       make(map[CommodityType]*OrderBook),
 	}
 
-	for _, c := range AllCommodities {
-		m.Modifier[c] = 1.00
+	for _, c := range commodities {
+		m.types = append(m.types, c.ID)
+		m.Modifier[c.ID] = 1.00
+		m.Books[c.ID] = NewOrderBook()
 
-		m.Commodities[c] = &Commodity{
-			Name:   string(c),
-			Supply: 100,
-			Value:  100.00,
-			Demand: 100,
+		m.Commodities[c.ID] = &Commodity{
+			Name:       c.Name,
+			Supply:     c.Supply,
+			Value:      c.Value,
+			Demand:     c.Demand,
+			Baseline:   c.Supply,
+			BaseDemand: c.Demand,
 		}
 	}
 
 	return m
 }
 
+// Types returns every commodity traded in the market.
+func (m *Market) Types() []CommodityType {
+	return m.types
+}
+
+// ApplyModifier multiplies the price of each commodity by its modifier.
+// Commodities without a modifier are left unchanged.
 func (m *Market) ApplyModifier(modifier map[CommodityType]float64) {
-	for _, c := range AllCommodities {
-		m.Modifier[c] *= modifier[c]
+	for _, c := range m.types {
+		if mod, ok := modifier[c]; ok {
+			m.Modifier[c] *= mod
+		}
 	}
 }
 
 func (m *Market) Prices() map[CommodityType]float64 {
 	prices := make(map[CommodityType]float64)
-	for _, c := range AllCommodities {
+	for _, c := range m.types {
 		prices[c] = m.Modifier[c] * m.Commodities[c].Price()
 	}
 
 	return prices
 }
 
+// Evolve moves the market on between rounds. In each commodity, the market
+// consumes some of its supply, closing the given fraction of the gap between
+// the supply and its baseline. Demand takes a step of a random walk, whose
+// size is set by the drift, and whose steps are drawn from r.
+func (m *Market) Evolve(recovery, drift float64, r *rand.Rand) {
+	for _, t := range m.types {
+		c := m.Commodities[t]
+		c.Recover(recovery)
+		c.Drift(drift, r)
+	}
+}
+
 // Sell returns the unit price of the commodity after it has been sold.
 func (m *Market) Sell(t CommodityType, quantity int64) (float64, error) {
 	c, ok := m.Commodities[t]
 	if !ok {
-		return 0, fmt.Errorf("Invalid commodity type: %v", t)
+		return 0, NewGameError(InvalidRequestError, "Invalid commodity type: %v", t)
 	}
 	return m.Modifier[t] * c.Sell(quantity), nil
 }
 
+// CheckMaterials returns an error if any of the materials aren't traded in
+// the market.
+func (m *Market) CheckMaterials(materials Materials) error {
+	for t := range materials {
+		if _, ok := m.Commodities[t]; !ok {
+			return NewGameError(InvalidRequestError, "Invalid commodity type: %v", t)
+		}
+	}
+	return nil
+}
+
+// BuyPrice returns the unit price that buying the commodity would cost,
+// without buying it. It fails if the market doesn't hold enough.
+func (m *Market) BuyPrice(t CommodityType, quantity int64) (float64, error) {
+	c, ok := m.Commodities[t]
+	if !ok {
+		return 0, NewGameError(InvalidRequestError, "Invalid commodity type: %v", t)
+	}
+	if quantity > c.Supply {
+		return 0, NewGameError(InvalidRequestError,
+			"Not enough %v for sale: want %v, have %v", t, quantity, c.Supply)
+	}
+	return m.Modifier[t] * c.BuyPrice(quantity), nil
+}
+
+// Buy returns the unit price of the commodity after it has been bought.
+func (m *Market) Buy(t CommodityType, quantity int64) (float64, error) {
+	price, err := m.BuyPrice(t, quantity)
+	if err != nil {
+		return 0, err
+	}
+	m.Commodities[t].Buy(quantity)
+	return price, nil
+}
+
+// PlaceOrder gives the order an ID, and matches it against the order book for
+// its commodity. It returns the fills, and leaves whatever isn't filled
+// standing in the book.
+func (m *Market) PlaceOrder(o *Order) ([]Fill, error) {
+	if err := m.CheckOrder(o); err != nil {
+		return nil, err
+	}
+	m.nextOrderID++
+	o.ID = m.nextOrderID
+	return m.Books[o.Type].Place(o), nil
+}
+
+// CheckOrder returns an error if the order can't be placed.
+func (m *Market) CheckOrder(o *Order) error {
+	if _, ok := m.Books[o.Type]; !ok {
+		return NewGameError(InvalidRequestError, "Invalid commodity type: %v", o.Type)
+	}
+	if o.Side != BidSide && o.Side != AskSide {
+		return NewGameError(InvalidRequestError, "Invalid order side: %q", o.Side)
+	}
+	if o.Quantity <= 0 {
+		return NewGameError(InvalidRequestError, "Invalid quantity: %v", o.Quantity)
+	}
+	if !(o.Price > 0) || math.IsInf(o.Price, 0) {
+		return NewGameError(InvalidRequestError, "Invalid price: %v", o.Price)
+	}
+	// Players can't trade with themselves.
+	if m.Books[o.Type].CrossesOwn(o) {
+		return NewGameError(InvalidRequestError,
+			"Order %v at %v would fill against your own order", o.Side, o.Price)
+	}
+	return nil
+}
+
+// CancelOrder removes an order from whichever book it's in. Users can only
+// cancel their own orders.
+func (m *Market) CancelOrder(owner User, id int64) (*Order, error) {
+	for _, t := range m.types {
+		if o := m.Books[t].Find(id); o != nil && o.Owner == owner {
+			m.Books[t].Cancel(id)
+			return o, nil
+		}
+	}
+	return nil, NewGameError(InvalidRequestError, "No such order: %v", id)
+}
+
 type Commodity struct {
 	// Name is the name of the commodity.
 	Name string
@@ -80,6 +266,40 @@ type Commodity struct {
 	// Demand is the number which, when supply = demand, the price is 1/2
 	// of the Value.
 	Demand float64
+
+	// Baseline is the supply which the market tends towards between rounds,
+	// and BaseDemand is the demand that the random walk starts from.
+	Baseline   int64
+	BaseDemand float64
+}
+
+// Recover closes the given fraction of the gap between the supply and the
+// baseline. It always moves at least one unit, so that the supply does get
+// back to the baseline.
+func (c *Commodity) Recover(fraction float64) {
+	gap := float64(c.Supply - c.Baseline)
+	step := int64(math.Round(gap * fraction))
+	if step == 0 && fraction > 0 {
+		switch {
+		case gap > 0:
+			step = 1
+		case gap < 0:
+			step = -1
+		}
+	}
+	c.Supply -= step
+}
+
+// Drift multiplies the demand by a random factor, whose logarithm is
+// normally distributed with the given standard deviation. The demand is kept
+// within MaxDemandDrift of the BaseDemand.
+func (c *Commodity) Drift(stddev float64, r *rand.Rand) {
+	if stddev == 0 {
+		return
+	}
+	c.Demand *= math.Exp(r.NormFloat64() * stddev)
+	c.Demand = math.Max(c.Demand, c.BaseDemand/MaxDemandDrift)
+	c.Demand = math.Min(c.Demand, c.BaseDemand*MaxDemandDrift)
 }
 
 // Price returns the current market price for a single unit of the commodity,
@@ -100,3 +320,27 @@ func (c *Commodity) Sell(quantity int64) float64 {
 	// slight benefit to users that sell in bulk.
 	return (initialPrice + finalPrice) / 2
 }
+
+// BuyPrice returns the unit price of buying a quantity of items, without
+// buying them. It mirrors Sell: the supply goes down instead of up, so the
+// price rises with each item bought, and selling items then buying them back
+// costs the same as was made from the sale.
+func (c *Commodity) BuyPrice(quantity int64) float64 {
+	supply := c.Supply
+	c.Supply = supply - 1
+	initialPrice := c.Price()
+	c.Supply = supply - quantity
+	finalPrice := c.Price()
+	c.Supply = supply
+
+	return (initialPrice + finalPrice) / 2
+}
+
+// Buy takes a quantity of items to be bought, and returns the price that you
+// pay for buying it. The supply can't go below zero, so the quantity must be
+// no more than the supply.
+func (c *Commodity) Buy(quantity int64) float64 {
+	price := c.BuyPrice(quantity)
+	c.Supply -= quantity
+	return price
+}
@@ -1,6 +1,12 @@
 package main
 
-import "testing"
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
 
 func TestSellingCommodity(t *testing.T) {
 	c := Commodity{
@@ -38,3 +44,180 @@ func TestPriceDropsWhenSelling(t *testing.T) {
 			", want sale price > price after", price, after)
 	}
 }
+
+func TestLoadCommodities(t *testing.T) {
+	commodities, err := LoadCommodities("data/commodities.json")
+	if err != nil {
+		t.Fatalf("LoadCommodities(...) returned err: %v", err)
+	}
+	if diff := cmp.Diff(AllCommodities, commodities); diff != "" {
+		t.Errorf("LoadCommodities(...) differs from the built-in commodities (-want +got):\n%v", diff)
+	}
+}
+
+func TestValidateCommodities(t *testing.T) {
+	invalid := [][]CommodityInfo{
+		nil,
+		{{ID: "", Value: 1, Demand: 1}},
+		{{ID: "spice", Value: 1, Demand: 1}, {ID: "spice", Value: 2, Demand: 2}},
+		{{ID: "spice", Value: 1, Demand: 0}},
+		{{ID: "spice", Value: 1, Demand: 1, Supply: -1}},
+	}
+	for _, c := range invalid {
+		if err := ValidateCommodities(c); err == nil {
+			t.Errorf("ValidateCommodities(%v) succeeded", c)
+		}
+	}
+}
+
+func TestThemedMarket(t *testing.T) {
+	m := NewMarket([]CommodityInfo{
+		{ID: "saffron", Name: "Saffron", Value: 80, Demand: 10, Supply: 0},
+	})
+	if diff := cmp.Diff([]CommodityType{"saffron"}, m.Types()); diff != "" {
+		t.Errorf("m.Types() differs (-want +got):\n%v", diff)
+	}
+	if got := m.Prices()["saffron"]; got != 80 {
+		t.Errorf("Price of saffron = %v, want 80", got)
+	}
+	if _, err := m.Sell(Tomato, 1); err == nil {
+		t.Errorf("m.Sell(Tomato, 1) succeeded in a market without tomatoes")
+	}
+}
+
+func TestSupplyRecovers(t *testing.T) {
+	c := Commodity{
+		Supply:   100,
+		Value:    2.00,
+		Demand:   100,
+		Baseline: 100,
+	}
+	c.Sell(100)
+
+	// The surplus halves each round, so prices climb back towards where
+	// they started.
+	var trajectory []int64
+	prices := []float64{c.Price()}
+	for i := 0; i < 4; i++ {
+		c.Recover(0.5)
+		trajectory = append(trajectory, c.Supply)
+		prices = append(prices, c.Price())
+	}
+	if diff := cmp.Diff([]int64{150, 125, 112, 106}, trajectory); diff != "" {
+		t.Errorf("Supply trajectory differs (-want +got):\n%v", diff)
+	}
+	for i := 1; i < len(prices); i++ {
+		if prices[i] <= prices[i-1] {
+			t.Errorf("Price fell from %v to %v while supply recovered", prices[i-1], prices[i])
+		}
+	}
+
+	// Without recovery, the price stays put.
+	before := c.Price()
+	c.Recover(0)
+	if after := c.Price(); after != before {
+		t.Errorf("Price changed from %v to %v without recovery", before, after)
+	}
+
+	// Small gaps still close, however slow the recovery.
+	for _, supply := range []int64{101, 99} {
+		c.Supply = supply
+		c.Recover(0.4)
+		if c.Supply != c.Baseline {
+			t.Errorf("Supply %v recovered to %v, want %v", supply, c.Supply, c.Baseline)
+		}
+	}
+}
+
+func TestDemandDrifts(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	c := Commodity{
+		Supply:     100,
+		Value:      2.00,
+		Demand:     100,
+		Baseline:   100,
+		BaseDemand: 100,
+	}
+
+	changed := false
+	for i := 0; i < 1000; i++ {
+		before := c.Demand
+		c.Drift(0.5, r)
+		if c.Demand != before {
+			changed = true
+		}
+		if c.Demand < 100/MaxDemandDrift || c.Demand > 100*MaxDemandDrift {
+			t.Fatalf("Demand drifted out of bounds after %v rounds: %v", i, c.Demand)
+		}
+	}
+	if !changed {
+		t.Errorf("Demand never drifted")
+	}
+
+	// Without drift, demand stays put.
+	before := c.Demand
+	c.Drift(0, r)
+	if c.Demand != before {
+		t.Errorf("Demand changed from %v to %v without drift", before, c.Demand)
+	}
+}
+
+func TestMarketEvolvesDeterministically(t *testing.T) {
+	trajectory := func() []float64 {
+		r := rand.New(rand.NewSource(1))
+		m := NewMarket(AllCommodities)
+		m.Sell(Tomato, 50)
+		var prices []float64
+		for i := 0; i < 5; i++ {
+			m.Evolve(0.5, 0.1, r)
+			prices = append(prices, m.Prices()[Tomato])
+		}
+		return prices
+	}
+	if diff := cmp.Diff(trajectory(), trajectory()); diff != "" {
+		t.Errorf("Price trajectories differ with the same seed (-first +second):\n%v", diff)
+	}
+}
+
+func TestBuyingBackCostsTheSame(t *testing.T) {
+	c := Commodity{
+		Supply: 100,
+		Value:  2.00,
+		Demand: 100,
+	}
+
+	before := c.Price()
+	earned := c.Sell(10) * 10
+	paid := c.Buy(10) * 10
+	if math.Abs(earned-paid) > 1e-9 {
+		t.Errorf("Selling 10 earned %v, but buying them back cost %v", earned, paid)
+	}
+	if after := c.Price(); after != before {
+		t.Errorf("c.Price() = %v after buying back, want %v", after, before)
+	}
+
+	// Buying raises the price.
+	price := c.Buy(50)
+	if after := c.Price(); price <= before || after <= price {
+		t.Errorf("Prices before (%v), during (%v) and after (%v) buying, want increasing",
+			before, price, after)
+	}
+}
+
+func TestBuyingIsBoundedBySupply(t *testing.T) {
+	m := NewMarket(AllCommodities)
+	m.Commodities[Corn].Supply = 5
+
+	if _, err := m.Buy(Corn, 6); err == nil {
+		t.Errorf("m.Buy(Corn, 6) succeeded with a supply of 5")
+	}
+	if _, err := m.Buy(Corn, 5); err != nil {
+		t.Errorf("m.Buy(Corn, 5) failed: %v", err)
+	}
+	if supply := m.Commodities[Corn].Supply; supply != 0 {
+		t.Errorf("Supply of corn = %v, want 0", supply)
+	}
+	if _, err := m.Buy("spice", 1); err == nil {
+		t.Errorf("m.Buy(\"spice\", 1) succeeded")
+	}
+}
@@ -2,7 +2,7 @@ package main
 
 import (
 	"encoding/json"
-	"fmt"
+	"reflect"
 	"time"
 )
 
@@ -14,33 +14,110 @@ type MessageAction string
 const (
 	// Server broadcast messages
 	GameStateChangedAction MessageAction = "game_state_changed"
-	AuctionSeedAction      MessageAction = "auction_seed"
+	AuctionCardAction      MessageAction = "auction_card"
 	WelcomeAction          MessageAction = "welcome"
 	PriceUpdatedAction     MessageAction = "price_updated"
 	BidUpdatedAction       MessageAction = "bid_updated"
+	AuctionPriceAction     MessageAction = "auction_price"
 	SetClockAction         MessageAction = "set_clock"
 	EffectAction           MessageAction = "effect_updated"
 	PlayerInfoUpdateAction MessageAction = "player_info_updated"
+	PlayerLeftAction       MessageAction = "player_left"
+	GameClosedAction       MessageAction = "game_closed"
+	GameOverAction         MessageAction = "game_over"
+	RoundSummaryAction     MessageAction = "round_summary"
+	OrderBookAction        MessageAction = "order_book"
 
 	// Server-to-client messages
 	AuctionWonAction     MessageAction = "auction_won"
+	BidReceivedAction    MessageAction = "bid_received"
 	TradeCompletedAction MessageAction = "trade_completed"
+	TradeExpiredAction   MessageAction = "trade_expired"
+	TradeProposalAction  MessageAction = "trade_proposal"
+	TradeDeclinedAction  MessageAction = "trade_declined"
 	SaleCompletedAction  MessageAction = "sale_completed"
+	PurchaseAction       MessageAction = "purchase_completed"
+	OrderPlacedAction    MessageAction = "order_placed"
+	OrderFilledAction    MessageAction = "order_filled"
+	OrderCancelledAction MessageAction = "order_cancelled"
+	ErrorAction          MessageAction = "error"
+	InventoryAction      MessageAction = "inventory_updated"
+	SessionAction        MessageAction = "session"
+	StateSnapshotAction  MessageAction = "state_snapshot"
 
 	// Client messages
-	BidAction         MessageAction = "bid"
-	ReadyAction       MessageAction = "ready"
-	JoinAction        MessageAction = "join"
-	LeaveAction       MessageAction = "leave"
-	TradeAction       MessageAction = "trade"
-	SellAction        MessageAction = "sell"
-	SetNameAction     MessageAction = "set_name"
-	ApplyEffectAction MessageAction = "apply_effect"
+	BidAction          MessageAction = "bid"
+	ReadyAction        MessageAction = "ready"
+	JoinAction         MessageAction = "join"
+	LeaveAction        MessageAction = "leave"
+	ResumeAction       MessageAction = "resume"
+	TradeAction        MessageAction = "trade"
+	TradeAcceptAction  MessageAction = "trade_accept"
+	TradeDeclineAction MessageAction = "trade_decline"
+	SellAction         MessageAction = "sell"
+	BuyAction          MessageAction = "buy"
+	PlaceOrderAction   MessageAction = "place_order"
+	CancelOrderAction  MessageAction = "cancel_order"
+	PlantAction        MessageAction = "plant"
+	SetNameAction      MessageAction = "set_name"
+	ApplyEffectAction  MessageAction = "apply_effect"
 
 	// Special debug-only actions
 	TickAction MessageAction = "tick"
 )
 
+// MessageOrigin describes who is allowed to send a particular kind of message.
+type MessageOrigin int
+
+const (
+	// ClientOrigin messages may be sent by any player.
+	ClientOrigin MessageOrigin = iota
+	// AdminOrigin messages may only be sent by players who joined the game
+	// with the admin token.
+	AdminOrigin
+	// InternalOrigin messages may only be generated by the server itself.
+	InternalOrigin
+)
+
+// ActionOrigins lists the least privileged origin which is allowed to send
+// each action. Actions which aren't listed, such as messages that the server
+// sends to clients, are treated as internal.
+var ActionOrigins = map[MessageAction]MessageOrigin{
+	BidAction:   ClientOrigin,
+	ReadyAction: ClientOrigin,
+	TradeAction: ClientOrigin,
+	SellAction:  ClientOrigin,
+	BuyAction:   ClientOrigin,
+
+	PlaceOrderAction:   ClientOrigin,
+	TradeAcceptAction:  ClientOrigin,
+	TradeDeclineAction: ClientOrigin,
+	CancelOrderAction:  ClientOrigin,
+	PlantAction:        ClientOrigin,
+	SetNameAction:      ClientOrigin,
+	LeaveAction:        ClientOrigin,
+
+	ApplyEffectAction: AdminOrigin,
+
+	JoinAction:   InternalOrigin,
+	ResumeAction: InternalOrigin,
+	TickAction:   InternalOrigin,
+}
+
+// CheckOrigin returns an error if a message with the given action may not be
+// sent from the given origin. Actions which aren't listed in ActionOrigins,
+// such as those that the server sends, may only be sent internally.
+func CheckOrigin(action MessageAction, origin MessageOrigin) error {
+	required, ok := ActionOrigins[action]
+	if !ok {
+		required = InternalOrigin
+	}
+	if origin < required {
+		return NewGameError(ForbiddenError, "Not permitted to send action: %v", action)
+	}
+	return nil
+}
+
 // A Message is an object which must contain an Action string, serializable
 // to the MessageAction, and may also contain other JSON serializable fields.
 type Message interface{}
@@ -51,6 +128,7 @@ type Message interface{}
 // message.
 type BasicMessage struct {
 	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
 }
 
 // TickMessage is sent to increment the current game clock. Users shouldn't send
@@ -81,41 +159,71 @@ func NewGameStateChangedMessage(newState GameState) Message {
 	}
 }
 
-type AuctionSeedMessage struct {
+// AuctionCardMessage announces the card that is currently up for auction.
+type AuctionCardMessage struct {
 	Action string `json:"action"`
-	Seed   int    `json:"seed"`
+	Card   Card   `json:"card"`
 }
 
-func NewAuctionSeedMessage(seed int) Message {
-	return AuctionSeedMessage{
-		Action: string(AuctionSeedAction),
-		Seed:   seed,
+func NewAuctionCardMessage(card Card) Message {
+	return AuctionCardMessage{
+		Action: string(AuctionCardAction),
+		Card:   card,
 	}
 }
 
+// BidUpdatedMessage announces the new highest bid. The ID is that of the
+// winner's BidMessage, so that they can tell which of their bids it was.
 type BidUpdatedMessage struct {
 	Action string `json:"action"`
 	Bid    int    `json:"bid"`
 	Winner string `json:"winner"`
+	ID     string `json:"id,omitempty"`
 }
 
-func NewBidUpdatedMessage(bid int, winner string) Message {
+func NewBidUpdatedMessage(bid int, winner, id string) Message {
 	return BidUpdatedMessage{
 		Action: string(BidUpdatedAction),
 		Bid:    bid,
 		Winner: winner,
+		ID:     id,
 	}
 }
 
+// AuctionPriceMessage announces the asking price of a Dutch auction, each
+// time that it drops.
+type AuctionPriceMessage struct {
+	Action string `json:"action"`
+	Price  int    `json:"price"`
+}
+
+func NewAuctionPriceMessage(price int) Message {
+	return AuctionPriceMessage{
+		Action: string(AuctionPriceAction),
+		Price:  price,
+	}
+}
+
+// EffectInfo describes an effect which is currently active, and how many
+// milliseconds remain before it expires.
+type EffectInfo struct {
+	Name              string                    `json:"name"`
+	YieldRateModifier map[CommodityType]float64 `json:"yield_rate_modifier"`
+	PriceModifier     map[CommodityType]float64 `json:"price_modifier"`
+	Remaining         int                       `json:"remaining"`
+}
+
 type EffectMessage struct {
 	Action string                    `json:"action"`
 	Yield  map[CommodityType]float64 `json:"yield_rate_modifier"`
+	Active []EffectInfo              `json:"active_effects"`
 }
 
-func NewEffectMessage(yield map[CommodityType]float64) Message {
+func NewEffectMessage(yield map[CommodityType]float64, active []EffectInfo) Message {
 	return EffectMessage{
 		Action: string(EffectAction),
 		Yield:  yield,
+		Active: active,
 	}
 }
 
@@ -148,28 +256,236 @@ func NewPlayerInfoUpdateMessage(info []PlayerInfo) Message {
 	}
 }
 
+// PlayerLeftMessage announces that a player has left the game for good.
+type PlayerLeftMessage struct {
+	Action string `json:"action"`
+	Name   string `json:"name"`
+}
+
+func NewPlayerLeftMessage(name string) Message {
+	return PlayerLeftMessage{
+		Action: string(PlayerLeftAction),
+		Name:   name,
+	}
+}
+
+// AuctionPurchase is a card which a player won at auction, and the price that
+// they paid for it.
+type AuctionPurchase struct {
+	Card  string `json:"card"`
+	Price int    `json:"price"`
+}
+
+// RoundPlayerSummary describes what a player did during a round. Earnings
+// is the money made by selling, both to the market and through the order
+// books.
+type RoundPlayerSummary struct {
+	Name      string            `json:"name"`
+	Earnings  float64           `json:"earnings"`
+	Purchases []AuctionPurchase `json:"purchases"`
+	Trades    int               `json:"trades"`
+}
+
+// PriceMovement is the price of a commodity at the start and end of a round.
+type PriceMovement struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+}
+
+// RoundSummaryMessage is broadcast at the end of every round.
+type RoundSummaryMessage struct {
+	Action  string                          `json:"action"`
+	Round   int                             `json:"round"`
+	Players []RoundPlayerSummary            `json:"players"`
+	Prices  map[CommodityType]PriceMovement `json:"prices"`
+}
+
+func NewRoundSummaryMessage(round int, players []RoundPlayerSummary, prices map[CommodityType]PriceMovement) Message {
+	return RoundSummaryMessage{
+		Action:  string(RoundSummaryAction),
+		Round:   round,
+		Players: players,
+		Prices:  prices,
+	}
+}
+
+// OrderBookMessage describes the depth of the order book for a commodity: the
+// total quantity bid and asked at each price, best prices first.
+type OrderBookMessage struct {
+	Action string       `json:"action"`
+	Type   string       `json:"type"`
+	Bids   []PriceLevel `json:"bids"`
+	Asks   []PriceLevel `json:"asks"`
+}
+
+func NewOrderBookMessage(t CommodityType, book *OrderBook) OrderBookMessage {
+	bids, asks := book.Depth()
+	return OrderBookMessage{
+		Action: string(OrderBookAction),
+		Type:   string(t),
+		Bids:   bids,
+		Asks:   asks,
+	}
+}
+
+// The reasons that a game can end.
+const (
+	MaxRoundsReason    = "max_rounds"
+	TargetWealthReason = "target_wealth"
+	TimeLimitReason    = "time_limit"
+)
+
+// Standing is a player's place in the final standings of a game.
+type Standing struct {
+	Rank      int       `json:"rank"`
+	Name      string    `json:"name"`
+	NetWorth  float64   `json:"net_worth"`
+	Money     float64   `json:"money"`
+	Materials Materials `json:"materials"`
+}
+
+// GameOverMessage announces that the game has ended, and who won. The
+// standings are ranked from first to last.
+type GameOverMessage struct {
+	Action    string     `json:"action"`
+	Reason    string     `json:"reason"`
+	Winner    string     `json:"winner"`
+	Standings []Standing `json:"standings"`
+}
+
+func NewGameOverMessage(reason string, standings []Standing) Message {
+	m := GameOverMessage{
+		Action:    string(GameOverAction),
+		Reason:    reason,
+		Standings: standings,
+	}
+	if len(standings) > 0 {
+		m.Winner = standings[0].Name
+	}
+	return m
+}
+
+// GameClosedMessage is sent just before the server closes every connection
+// to a game, e.g. because the server is shutting down.
+type GameClosedMessage struct {
+	Action string `json:"action"`
+	Reason string `json:"reason"`
+}
+
+func NewGameClosedMessage(reason string) Message {
+	return GameClosedMessage{
+		Action: string(GameClosedAction),
+		Reason: reason,
+	}
+}
+
 // Server-to-client messages:
 
+// BidReceivedMessage tells a user that their bid in a sealed-bid auction has
+// been recorded. The ID is that of their BidMessage.
+type BidReceivedMessage struct {
+	Action string `json:"action"`
+	Bid    int    `json:"bid"`
+	ID     string `json:"id,omitempty"`
+}
+
+func NewBidReceivedMessage(bid BidMessage) Message {
+	return BidReceivedMessage{
+		Action: string(BidReceivedAction),
+		Bid:    bid.Amount,
+		ID:     bid.ID,
+	}
+}
+
+// TradeCompletedMessage tells a user which materials they received in a
+// trade. The ID is that of the user's own TradeMessage.
 type TradeCompletedMessage struct {
-	Action    string `json:"action"`
-	Materials string `json:"materials"`
+	Action string `json:"action"`
+	Offer
+	ID string `json:"id,omitempty"`
 }
 
-func NewTradeCompletedMessage(materials string) Message {
-	return TradeCompletedMessage{string(TradeCompletedAction), materials}
+func NewTradeCompletedMessage(received Offer, id string) Message {
+	return TradeCompletedMessage{
+		Action: string(TradeCompletedAction),
+		Offer:  received,
+		ID:     id,
+	}
 }
 
-type WelcomeMessage struct {
+// TradeExpiredMessage tells a user that nobody took up their trade offer
+// before it timed out. The ID is that of the user's TradeMessage.
+type TradeExpiredMessage struct {
 	Action string `json:"action"`
-	Game   string `json:"game"`
-	State  string `json:"state"`
+	Offer
+	ID string `json:"id,omitempty"`
+}
+
+func NewTradeExpiredMessage(trade TradeMessage) Message {
+	return TradeExpiredMessage{
+		Action: string(TradeExpiredAction),
+		Offer:  trade.Offer,
+		ID:     trade.ID,
+	}
+}
+
+// TradeProposalMessage shows a user the offer that they've been paired with,
+// when trades must be confirmed. They have Timeout milliseconds to accept
+// or decline it. The ID is that of the user's own TradeMessage.
+type TradeProposalMessage struct {
+	Action     string `json:"action"`
+	ProposalID int64  `json:"proposal_id"`
+	Partner    string `json:"partner"`
+	Offer
+	Timeout int64  `json:"timeout_ms"`
+	ID      string `json:"id,omitempty"`
 }
 
-func NewWelcomeMessage(game, state string) Message {
+func NewTradeProposalMessage(p *TradeProposal, u User, timeout time.Duration) Message {
+	own, other := p.Sides(u)
+	return TradeProposalMessage{
+		Action:     string(TradeProposalAction),
+		ProposalID: p.ID,
+		Partner:    other.User.Name(),
+		Offer:      other.Trade.Offer,
+		Timeout:    int64(timeout / time.Millisecond),
+		ID:         own.Trade.ID,
+	}
+}
+
+// TradeDeclinedMessage tells a user that a proposed trade has been called
+// off, because one of the players declined it or left. The ID is that of
+// the user's own TradeMessage.
+type TradeDeclinedMessage struct {
+	Action     string `json:"action"`
+	ProposalID int64  `json:"proposal_id"`
+	ID         string `json:"id,omitempty"`
+}
+
+func NewTradeDeclinedMessage(p *TradeProposal, u User) Message {
+	own, _ := p.Sides(u)
+	return TradeDeclinedMessage{
+		Action:     string(TradeDeclinedAction),
+		ProposalID: p.ID,
+		ID:         own.Trade.ID,
+	}
+}
+
+// WelcomeMessage greets a player who has joined a game, and tells them which
+// commodities the game is played with.
+type WelcomeMessage struct {
+	Action      string          `json:"action"`
+	Game        string          `json:"game"`
+	State       string          `json:"state"`
+	Commodities []CommodityInfo `json:"commodities"`
+}
+
+func NewWelcomeMessage(game, state string, commodities []CommodityInfo) Message {
 	return WelcomeMessage{
-		Action: string(WelcomeAction),
-		Game:   game,
-		State:  state,
+		Action:      string(WelcomeAction),
+		Game:        game,
+		State:       state,
+		Commodities: commodities,
 	}
 }
 
@@ -192,6 +508,7 @@ type SaleCompletedMessage struct {
 	Quantity int64   `json:"quantity"`
 	Type     string  `json:"type"`
 	Price    float64 `json:"price"`
+	ID       string  `json:"id,omitempty"`
 }
 
 func NewSaleCompletedMessage(s SellMessage, price float64) Message {
@@ -200,14 +517,192 @@ func NewSaleCompletedMessage(s SellMessage, price float64) Message {
 		Quantity: s.Quantity,
 		Type:     s.Type,
 		Price:    price,
+		ID:       s.ID,
+	}
+}
+
+// PurchaseCompletedMessage is sent when a purchase from the market is
+// completed. It includes the actual unit price that the user paid.
+type PurchaseCompletedMessage struct {
+	Action   string  `json:"action"`
+	Quantity int64   `json:"quantity"`
+	Type     string  `json:"type"`
+	Price    float64 `json:"price"`
+	ID       string  `json:"id,omitempty"`
+}
+
+func NewPurchaseCompletedMessage(b BuyMessage, price float64) Message {
+	return PurchaseCompletedMessage{
+		Action:   string(PurchaseAction),
+		Quantity: b.Quantity,
+		Type:     b.Type,
+		Price:    price,
+		ID:       b.ID,
+	}
+}
+
+// OrderPlacedMessage tells a user that their order has been accepted, and
+// which order ID it was given. Quantity is what was left standing in the
+// book once the order was matched.
+type OrderPlacedMessage struct {
+	Action   string  `json:"action"`
+	OrderID  int64   `json:"order_id"`
+	Type     string  `json:"type"`
+	Side     string  `json:"side"`
+	Price    float64 `json:"price"`
+	Quantity int64   `json:"quantity"`
+	ID       string  `json:"id,omitempty"`
+}
+
+func NewOrderPlacedMessage(o *Order) Message {
+	return OrderPlacedMessage{
+		Action:   string(OrderPlacedAction),
+		OrderID:  o.ID,
+		Type:     string(o.Type),
+		Side:     string(o.Side),
+		Price:    o.Price,
+		Quantity: o.Quantity,
+		ID:       o.ClientID,
+	}
+}
+
+// OrderFilledMessage tells a user that some or all of their order has been
+// filled. Price is the unit price that the goods changed hands at, and
+// Remaining is the quantity still standing in the book.
+type OrderFilledMessage struct {
+	Action    string  `json:"action"`
+	OrderID   int64   `json:"order_id"`
+	Type      string  `json:"type"`
+	Side      string  `json:"side"`
+	Price     float64 `json:"price"`
+	Quantity  int64   `json:"quantity"`
+	Remaining int64   `json:"remaining"`
+	ID        string  `json:"id,omitempty"`
+}
+
+func NewOrderFilledMessage(o *Order, price float64, quantity int64) Message {
+	return OrderFilledMessage{
+		Action:    string(OrderFilledAction),
+		OrderID:   o.ID,
+		Type:      string(o.Type),
+		Side:      string(o.Side),
+		Price:     price,
+		Quantity:  quantity,
+		Remaining: o.Quantity,
+		ID:        o.ClientID,
+	}
+}
+
+// OrderCancelledMessage tells a user that their order has been taken out of
+// the book, either because they asked or because trading is over. Whatever
+// was held back for the order is returned to them.
+type OrderCancelledMessage struct {
+	Action    string `json:"action"`
+	OrderID   int64  `json:"order_id"`
+	Remaining int64  `json:"remaining"`
+	ID        string `json:"id,omitempty"`
+}
+
+func NewOrderCancelledMessage(o *Order) Message {
+	return OrderCancelledMessage{
+		Action:    string(OrderCancelledAction),
+		OrderID:   o.ID,
+		Remaining: o.Quantity,
+		ID:        o.ClientID,
+	}
+}
+
+// ErrorMessage is sent to a user when the server refuses to act on one of
+// their messages, e.g. because they can't afford it. Offending is the action
+// of the message which was refused, and ID is its ID, if they're known.
+type ErrorMessage struct {
+	Action    string `json:"action"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Offending string `json:"offending_action"`
+	ID        string `json:"id,omitempty"`
+}
+
+func NewErrorMessage(offending Message, err error) Message {
+	return ErrorMessage{
+		Action:    string(ErrorAction),
+		Code:      string(ErrorCodeOf(err)),
+		Message:   err.Error(),
+		Offending: string(ActionOf(offending)),
+		ID:        IDOf(offending),
+	}
+}
+
+// InventoryUpdatedMessage tells a user what they hold according to the
+// server's ledger. Harvest is the part of their materials that was produced
+// during the last production phase.
+type InventoryUpdatedMessage struct {
+	Action    string    `json:"action"`
+	Money     float64   `json:"money"`
+	Materials Materials `json:"materials"`
+	Factories Materials `json:"factories"`
+	Harvest   Materials `json:"harvest"`
+}
+
+func NewInventoryUpdatedMessage(account *Account, harvest Materials) Message {
+	return InventoryUpdatedMessage{
+		Action:    string(InventoryAction),
+		Money:     account.Money,
+		Materials: account.Materials,
+		Factories: account.Factories,
+		Harvest:   harvest,
 	}
 }
 
-// Client messages
+// AuctionInfo describes the auction which is currently running. Bids in
+// sealed-bid auctions aren't shown, and Price is the asking price of a Dutch
+// auction.
+type AuctionInfo struct {
+	Format AuctionType `json:"format"`
+	Card   Card        `json:"card"`
+	Bid    int         `json:"bid"`
+	Winner string      `json:"winner"`
+	Price  int         `json:"price,omitempty"`
+}
+
+// StateSnapshotMessage describes the whole state of the game, as seen by the
+// user that it's sent to. Clock is the time remaining in the current phase or
+// auction, in milliseconds, and Auction is only set during the auction phase.
+// Books holds the depth of every order book during the trading phase.
+type StateSnapshotMessage struct {
+	Action   string                    `json:"action"`
+	State    string                    `json:"state"`
+	Round    int                       `json:"round"`
+	Rounds   int                       `json:"max_rounds"`
+	Clock    int                       `json:"clock"`
+	Prices   map[CommodityType]float64 `json:"prices"`
+	Auction  *AuctionInfo              `json:"auction,omitempty"`
+	Books    []OrderBookMessage        `json:"order_books,omitempty"`
+	Players  []PlayerInfo              `json:"players"`
+	Holdings Account                   `json:"holdings"`
+}
+
+// SessionMessage gives a user the token which they can use to resume their
+// seat in the game if their connection drops.
+type SessionMessage struct {
+	Action  string `json:"action"`
+	Session string `json:"session"`
+}
+
+func NewSessionMessage(session string) Message {
+	return SessionMessage{
+		Action:  string(SessionAction),
+		Session: session,
+	}
+}
+
+// Client messages. Each of them may carry an optional ID, chosen by the
+// client, which the server echoes in its responses to the message.
 
 type BidMessage struct {
 	Action string `json:"action"`
 	Amount int    `json:"amount"`
+	ID     string `json:"id,omitempty"`
 }
 
 func NewBidMessage(amount int) Message {
@@ -228,6 +723,7 @@ func NewAuctionWonMessage() Message {
 type ReadyMessage struct {
 	Action string `json:"action"`
 	Ready  bool   `json:"ready"`
+	ID     string `json:"id,omitempty"`
 }
 
 func NewReadyMessage(ready bool) Message {
@@ -239,29 +735,48 @@ func NewReadyMessage(ready bool) Message {
 
 type JoinMessage struct {
 	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
 }
 
 func NewJoinMessage() Message {
-	return JoinMessage{string(JoinAction)}
+	return JoinMessage{Action: string(JoinAction)}
 }
 
 type LeaveMessage struct {
 	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
 }
 
 func NewLeaveMessage() Message {
-	return LeaveMessage{string(LeaveAction)}
+	return LeaveMessage{Action: string(LeaveAction)}
 }
 
+// ResumeMessage is generated internally when a user reconnects to a seat that
+// they had dropped.
+type ResumeMessage struct {
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
+}
+
+func NewResumeMessage() Message {
+	return ResumeMessage{Action: string(ResumeAction)}
+}
+
+// TradeMessage offers materials, and optionally money, to whichever player
+// the user bumps into. Clients which can tell who they bumped into, for
+// example through a proximity handshake, may set the same Hint on both
+// players' offers so that they're paired with each other.
 type TradeMessage struct {
-	Action    string `json:"action"`
-	Materials string `json:"materials"`
+	Action string `json:"action"`
+	Offer
+	Hint string `json:"hint,omitempty"`
+	ID   string `json:"id,omitempty"`
 }
 
-func NewTradeMessage(materials string) Message {
+func NewTradeMessage(materials Materials, money float64) TradeMessage {
 	return TradeMessage{
-		Action:    string(TradeAction),
-		Materials: materials,
+		Action: string(TradeAction),
+		Offer:  Offer{Materials: materials, Money: money},
 	}
 }
 
@@ -269,6 +784,7 @@ type SellMessage struct {
 	Action   string `json:"action"`
 	Quantity int64  `json:"quantity"`
 	Type     string `json:"type"`
+	ID       string `json:"id,omitempty"`
 }
 
 func NewSellMessage(t CommodityType, quantity int64) SellMessage {
@@ -279,9 +795,106 @@ func NewSellMessage(t CommodityType, quantity int64) SellMessage {
 	}
 }
 
+// BuyMessage is sent during the trading phase to buy goods from the market.
+type BuyMessage struct {
+	Action   string `json:"action"`
+	Quantity int64  `json:"quantity"`
+	Type     string `json:"type"`
+	ID       string `json:"id,omitempty"`
+}
+
+func NewBuyMessage(t CommodityType, quantity int64) BuyMessage {
+	return BuyMessage{
+		Action:   string(BuyAction),
+		Quantity: quantity,
+		Type:     string(t),
+	}
+}
+
+// PlaceOrderMessage is sent during the trading phase to place a limit order
+// in the order book for a commodity. Side is "bid" to buy, or "ask" to sell.
+type PlaceOrderMessage struct {
+	Action   string  `json:"action"`
+	Type     string  `json:"type"`
+	Side     string  `json:"side"`
+	Price    float64 `json:"price"`
+	Quantity int64   `json:"quantity"`
+	ID       string  `json:"id,omitempty"`
+}
+
+func NewPlaceOrderMessage(t CommodityType, side OrderSide, price float64, quantity int64) PlaceOrderMessage {
+	return PlaceOrderMessage{
+		Action:   string(PlaceOrderAction),
+		Type:     string(t),
+		Side:     string(side),
+		Price:    price,
+		Quantity: quantity,
+	}
+}
+
+// CancelOrderMessage is sent to take one of the user's orders out of the
+// order book.
+type CancelOrderMessage struct {
+	Action  string `json:"action"`
+	OrderID int64  `json:"order_id"`
+	ID      string `json:"id,omitempty"`
+}
+
+func NewCancelOrderMessage(orderID int64) CancelOrderMessage {
+	return CancelOrderMessage{
+		Action:  string(CancelOrderAction),
+		OrderID: orderID,
+	}
+}
+
+// TradeAcceptMessage agrees to a proposed trade. The trade is settled once
+// both players have agreed to it.
+type TradeAcceptMessage struct {
+	Action     string `json:"action"`
+	ProposalID int64  `json:"proposal_id"`
+	ID         string `json:"id,omitempty"`
+}
+
+func NewTradeAcceptMessage(proposalID int64) TradeAcceptMessage {
+	return TradeAcceptMessage{
+		Action:     string(TradeAcceptAction),
+		ProposalID: proposalID,
+	}
+}
+
+// TradeDeclineMessage calls off a proposed trade.
+type TradeDeclineMessage struct {
+	Action     string `json:"action"`
+	ProposalID int64  `json:"proposal_id"`
+	ID         string `json:"id,omitempty"`
+}
+
+func NewTradeDeclineMessage(proposalID int64) TradeDeclineMessage {
+	return TradeDeclineMessage{
+		Action:     string(TradeDeclineAction),
+		ProposalID: proposalID,
+	}
+}
+
+// PlantMessage is sent during the production phase to choose which kind of
+// factory the user will build. Only the last choice of the phase counts.
+type PlantMessage struct {
+	Action string `json:"action"`
+	Type   string `json:"type"`
+	ID     string `json:"id,omitempty"`
+}
+
+func NewPlantMessage(t CommodityType) PlantMessage {
+	return PlantMessage{
+		Action: string(PlantAction),
+		Type:   string(t),
+	}
+}
+
 type SetNameMessage struct {
 	Action string `json:"action"`
 	Name   string `json:"name"`
+	ID     string `json:"id,omitempty"`
 }
 
 func NewSetNameMessage(name string) SetNameMessage {
@@ -291,11 +904,16 @@ func NewSetNameMessage(name string) SetNameMessage {
 	}
 }
 
+// ApplyEffectMessage multiplies the yield rates and prices of commodities by
+// the given modifiers. The Timeout is in milliseconds, after which the effect
+// is reversed. A zero Timeout makes the effect permanent.
 type ApplyEffectMessage struct {
 	Action            string                    `json:"action"`
+	Name              string                    `json:"name"`
 	YieldRateModifier map[CommodityType]float64 `json:"yield_rate_modifier"`
 	PriceModifier     map[CommodityType]float64 `json:"price_modifier"`
-	Timeout           int64
+	Timeout           int64                     `json:"timeout_ms"`
+	ID                string                    `json:"id,omitempty"`
 }
 
 func NewApplyEffectMessage(yield, rate map[CommodityType]float64, timeout int64) Message {
@@ -307,82 +925,217 @@ func NewApplyEffectMessage(yield, rate map[CommodityType]float64, timeout int64)
 	}
 }
 
+// ActionOf returns the action of a decoded message.
+func ActionOf(m Message) MessageAction {
+	return MessageAction(stringField(m, "Action"))
+}
+
+// IDOf returns the ID of a decoded message, or an empty string if the
+// message doesn't have one.
+func IDOf(m Message) string {
+	return stringField(m, "ID")
+}
+
+func stringField(m Message, name string) string {
+	v := reflect.ValueOf(m)
+	if v.Kind() != reflect.Struct {
+		return ""
+	}
+	if f := v.FieldByName(name); f.Kind() == reflect.String {
+		return f.String()
+	}
+	return ""
+}
+
+// DecodeBasicMessage reads the action and ID of a message, without decoding
+// the rest of it.
+func DecodeBasicMessage(data []byte) (BasicMessage, error) {
+	msg := BasicMessage{}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return msg, NewGameError(InvalidMessageError, "Unable to decode message: %q", data)
+	}
+	return msg, nil
+}
+
 // DecodeMessage takes data in bytes, determines which message it corresponds
 // to, and decodes it to the appropriate type.
 func DecodeMessage(data []byte) (Message, error) {
-	msg := BasicMessage{}
-	if err := json.Unmarshal(data, &msg); err != nil {
-		return nil, fmt.Errorf("Unable to decode message: %q", data)
+	basic, err := DecodeBasicMessage(data)
+	if err != nil {
+		return nil, err
 	}
+	action := MessageAction(basic.Action)
 
 	// Now that we know the type of the message (based on the action) we
 	// can decode it properly.
 	var message Message
-	var err error
-	switch msg.Action {
-	case string(GameStateChangedAction):
+	switch action {
+	case GameStateChangedAction:
 		m := GameStateChangedMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(AuctionSeedAction):
-		m := AuctionSeedMessage{}
+	case AuctionCardAction:
+		m := AuctionCardMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(WelcomeAction):
+	case WelcomeAction:
 		m := WelcomeMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(AuctionWonAction):
+	case AuctionWonAction:
 		m := AuctionWonMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(TradeCompletedAction):
+	case BidReceivedAction:
+		m := BidReceivedMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case AuctionPriceAction:
+		m := AuctionPriceMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case TradeCompletedAction:
 		m := TradeCompletedMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(BidAction):
+	case TradeExpiredAction:
+		m := TradeExpiredMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case TradeProposalAction:
+		m := TradeProposalMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case TradeDeclinedAction:
+		m := TradeDeclinedMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case BidAction:
 		m := BidMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(ReadyAction):
+	case ReadyAction:
 		m := ReadyMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(JoinAction):
+	case JoinAction:
 		m := JoinMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(LeaveAction):
+	case LeaveAction:
 		m := LeaveMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(TradeAction):
+	case PlayerLeftAction:
+		m := PlayerLeftMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case RoundSummaryAction:
+		m := RoundSummaryMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case GameOverAction:
+		m := GameOverMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case GameClosedAction:
+		m := GameClosedMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case ResumeAction:
+		m := ResumeMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case StateSnapshotAction:
+		m := StateSnapshotMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case SessionAction:
+		m := SessionMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case TradeAction:
 		m := TradeMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(TickAction):
+	case TickAction:
 		m := TickMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(SellAction):
+	case SellAction:
 		m := SellMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(SaleCompletedAction):
+	case SaleCompletedAction:
 		m := SaleCompletedMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(SetNameAction):
+	case PlaceOrderAction:
+		m := PlaceOrderMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case CancelOrderAction:
+		m := CancelOrderMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case TradeAcceptAction:
+		m := TradeAcceptMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case TradeDeclineAction:
+		m := TradeDeclineMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case OrderPlacedAction:
+		m := OrderPlacedMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case OrderFilledAction:
+		m := OrderFilledMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case OrderCancelledAction:
+		m := OrderCancelledMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case OrderBookAction:
+		m := OrderBookMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case BuyAction:
+		m := BuyMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case PurchaseAction:
+		m := PurchaseCompletedMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case ErrorAction:
+		m := ErrorMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case InventoryAction:
+		m := InventoryUpdatedMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case PlantAction:
+		m := PlantMessage{}
+		err = json.Unmarshal(data, &m)
+		message = m
+	case SetNameAction:
 		m := SetNameMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
-	case string(ApplyEffectAction):
+	case ApplyEffectAction:
 		m := ApplyEffectMessage{}
 		err = json.Unmarshal(data, &m)
 		message = m
 	default:
-		err = fmt.Errorf("Unknown action: %v", msg.Action)
+		return nil, NewGameError(UnknownActionError, "Unknown action: %v", action)
 	}
 
-	return message, err
+	if err != nil {
+		return nil, NewGameError(InvalidMessageError, "Unable to decode message: %q", data)
+	}
+	return message, nil
 }
@@ -3,16 +3,21 @@ package main
 import "testing"
 
 func TestMessageDecoding(t *testing.T) {
-	data := []byte(`{"action": "trade", "materials": "a hammer"}`)
+	data := []byte(`{"action": "trade", "materials": {"tomato": 2}, "money": 1.5}`)
 	msg, err := DecodeMessage(data)
 	if err != nil {
 		t.Errorf("DecodeMessage(...) returned err: %v", err)
 	}
 	trade := msg.(TradeMessage)
 
-	want := "a hammer"
-	if trade.Materials != want {
-		t.Errorf("trade.Materials = %q, want %q", trade.Materials, want)
+	if trade.Materials[Tomato] != 2 || trade.Money != 1.5 {
+		t.Errorf("trade.Offer = %+v, want 2 tomatoes and 1.5 money", trade.Offer)
+	}
+
+	// Materials can't be described any old way.
+	data = []byte(`{"action": "trade", "materials": "a hammer"}`)
+	if _, err := DecodeMessage(data); ErrorCodeOf(err) != InvalidMessageError {
+		t.Errorf("DecodeMessage(...) = %v, want %v", err, InvalidMessageError)
 	}
 }
 
@@ -30,3 +35,92 @@ func TestBidMessageDecoding(t *testing.T) {
 		t.Errorf("bid.Amount = %q, want %q", bid.Amount, want)
 	}
 }
+
+func TestCheckOrigin(t *testing.T) {
+	tests := []struct {
+		action  MessageAction
+		origin  MessageOrigin
+		allowed bool
+	}{
+		{BidAction, ClientOrigin, true},
+		{BidAction, InternalOrigin, true},
+		{ApplyEffectAction, ClientOrigin, false},
+		{ApplyEffectAction, AdminOrigin, true},
+		{TickAction, ClientOrigin, false},
+		{TickAction, AdminOrigin, false},
+		{TickAction, InternalOrigin, true},
+		{WelcomeAction, AdminOrigin, false},
+		{"unknown", ClientOrigin, false},
+	}
+
+	for _, test := range tests {
+		err := CheckOrigin(test.action, test.origin)
+		if allowed := err == nil; allowed != test.allowed {
+			t.Errorf("CheckOrigin(%v, %v) = %v, want allowed = %v",
+				test.action, test.origin, err, test.allowed)
+		}
+	}
+}
+
+func TestDecodeBasicMessage(t *testing.T) {
+	msg, err := DecodeBasicMessage([]byte(`{"action": "tick", "id": "7"}`))
+	if err != nil {
+		t.Errorf("DecodeBasicMessage(...) returned err: %v", err)
+	}
+	if msg.Action != string(TickAction) || msg.ID != "7" {
+		t.Errorf("DecodeBasicMessage(...) = %v, want tick with id 7", msg)
+	}
+
+	if _, err := DecodeBasicMessage([]byte("not json")); err == nil {
+		t.Errorf("DecodeBasicMessage(\"not json\") = nil, want error")
+	}
+}
+
+func TestMessageIDDecoding(t *testing.T) {
+	data := []byte(`{"action": "sell", "type": "corn", "quantity": 2, "id": "abc"}`)
+	msg, err := DecodeMessage(data)
+	if err != nil {
+		t.Errorf("DecodeMessage(...) returned err: %v", err)
+	}
+
+	if id := IDOf(msg); id != "abc" {
+		t.Errorf("IDOf(...) = %q, want %q", id, "abc")
+	}
+
+	// Errors about the message carry the same ID.
+	reply := NewErrorMessage(msg, NewGameError(InvalidRequestError, "nope"))
+	if id := reply.(ErrorMessage).ID; id != "abc" {
+		t.Errorf("NewErrorMessage(...).ID = %q, want %q", id, "abc")
+	}
+}
+
+func TestDecodeErrorCodes(t *testing.T) {
+	tests := []struct {
+		data string
+		code ErrorCode
+	}{
+		{`not json`, InvalidMessageError},
+		{`{"action": "fly"}`, UnknownActionError},
+		{`{"action": "bid", "amount": "lots"}`, InvalidMessageError},
+	}
+
+	for _, test := range tests {
+		_, err := DecodeMessage([]byte(test.data))
+		if err == nil {
+			t.Errorf("DecodeMessage(%q) = nil, want error", test.data)
+			continue
+		}
+		if code := ErrorCodeOf(err); code != test.code {
+			t.Errorf("DecodeMessage(%q) code = %v, want %v", test.data, code, test.code)
+		}
+	}
+}
+
+func TestActionOf(t *testing.T) {
+	if action := ActionOf(NewSellMessage(Tomato, 1)); action != SellAction {
+		t.Errorf("ActionOf(...) = %q, want %q", action, SellAction)
+	}
+	if action := ActionOf(nil); action != "" {
+		t.Errorf("ActionOf(nil) = %q, want \"\"", action)
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"sort"
+)
+
+// OrderSide says whether an order is to buy or to sell.
+type OrderSide string
+
+const (
+	BidSide OrderSide = "bid"
+	AskSide OrderSide = "ask"
+)
+
+// An Order is a standing offer from a player to buy (bid) or sell (ask) a
+// quantity of a commodity at a limit price. Quantity is what remains to be
+// filled. ClientID is the ID of the message that placed the order.
+type Order struct {
+	ID       int64
+	Owner    User
+	Side     OrderSide
+	Type     CommodityType
+	Price    float64
+	Quantity int64
+	ClientID string
+}
+
+// A Fill is a match between a bid and an ask. The goods change hands at the
+// price of whichever order was in the book first.
+type Fill struct {
+	Bid      *Order
+	Ask      *Order
+	Price    float64
+	Quantity int64
+}
+
+// PriceLevel is the total quantity offered at a price.
+type PriceLevel struct {
+	Price    float64 `json:"price"`
+	Quantity int64   `json:"quantity"`
+}
+
+// An OrderBook holds the standing orders for a single commodity, and matches
+// new orders against them with price-time priority: the best price goes
+// first, and orders at the same price go in the order they were placed.
+type OrderBook struct {
+	// bids are sorted from the highest price, and asks from the lowest.
+	// Orders at the same price are sorted by ID, which is the order they
+	// were placed in.
+	bids []*Order
+	asks []*Order
+}
+
+// NewOrderBook constructs an empty order book.
+func NewOrderBook() *OrderBook {
+	return &OrderBook{}
+}
+
+// Place matches an order against the book, and returns the fills. Whatever
+// isn't filled is left standing in the book.
+func (b *OrderBook) Place(o *Order) []Fill {
+	var fills []Fill
+	for o.Quantity > 0 {
+		opposite := b.side(opposite(o.Side))
+		if len(*opposite) == 0 {
+			break
+		}
+		best := (*opposite)[0]
+		if !crosses(o, best) {
+			break
+		}
+
+		quantity := min64(o.Quantity, best.Quantity)
+		fill := Fill{Price: best.Price, Quantity: quantity}
+		if o.Side == BidSide {
+			fill.Bid, fill.Ask = o, best
+		} else {
+			fill.Bid, fill.Ask = best, o
+		}
+		fills = append(fills, fill)
+
+		o.Quantity -= quantity
+		best.Quantity -= quantity
+		if best.Quantity == 0 {
+			*opposite = (*opposite)[1:]
+		}
+	}
+
+	if o.Quantity > 0 {
+		b.insert(o)
+	}
+	return fills
+}
+
+// CrossesOwn returns true if the order would fill against one of its owner's
+// own resting orders.
+func (b *OrderBook) CrossesOwn(o *Order) bool {
+	for _, resting := range *b.side(opposite(o.Side)) {
+		if resting.Owner == o.Owner && crosses(o, resting) {
+			return true
+		}
+	}
+	return false
+}
+
+// Find returns the order with the ID, or nil if it isn't in the book.
+func (b *OrderBook) Find(id int64) *Order {
+	for _, orders := range [][]*Order{b.bids, b.asks} {
+		for _, o := range orders {
+			if o.ID == id {
+				return o
+			}
+		}
+	}
+	return nil
+}
+
+// Cancel removes an order from the book, returning false if it isn't there.
+func (b *OrderBook) Cancel(id int64) (*Order, bool) {
+	for _, orders := range []*[]*Order{&b.bids, &b.asks} {
+		for i, o := range *orders {
+			if o.ID == id {
+				*orders = append((*orders)[:i], (*orders)[i+1:]...)
+				return o, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Remove takes every order placed by the owner out of the book, and returns
+// them.
+func (b *OrderBook) Remove(owner User) []*Order {
+	var removed []*Order
+	for _, orders := range []*[]*Order{&b.bids, &b.asks} {
+		kept := (*orders)[:0]
+		for _, o := range *orders {
+			if o.Owner == owner {
+				removed = append(removed, o)
+			} else {
+				kept = append(kept, o)
+			}
+		}
+		*orders = kept
+	}
+	return removed
+}
+
+// Clear takes every order out of the book, and returns them.
+func (b *OrderBook) Clear() []*Order {
+	orders := append(b.bids, b.asks...)
+	b.bids = nil
+	b.asks = nil
+	return orders
+}
+
+// Depth returns the total quantity bid and asked at each price, best prices
+// first.
+func (b *OrderBook) Depth() (bids, asks []PriceLevel) {
+	return depth(b.bids), depth(b.asks)
+}
+
+func (b *OrderBook) side(side OrderSide) *[]*Order {
+	if side == BidSide {
+		return &b.bids
+	}
+	return &b.asks
+}
+
+func (b *OrderBook) insert(o *Order) {
+	orders := b.side(o.Side)
+	i := sort.Search(len(*orders), func(i int) bool {
+		if o.Side == BidSide {
+			return (*orders)[i].Price < o.Price
+		}
+		return (*orders)[i].Price > o.Price
+	})
+	*orders = append(*orders, nil)
+	copy((*orders)[i+1:], (*orders)[i:])
+	(*orders)[i] = o
+}
+
+func depth(orders []*Order) []PriceLevel {
+	levels := []PriceLevel{}
+	for _, o := range orders {
+		if n := len(levels); n > 0 && levels[n-1].Price == o.Price {
+			levels[n-1].Quantity += o.Quantity
+		} else {
+			levels = append(levels, PriceLevel{Price: o.Price, Quantity: o.Quantity})
+		}
+	}
+	return levels
+}
+
+func opposite(side OrderSide) OrderSide {
+	if side == BidSide {
+		return AskSide
+	}
+	return BidSide
+}
+
+// crosses returns true if the incoming order can be filled by the resting
+// order.
+func crosses(incoming, resting *Order) bool {
+	if incoming.Side == BidSide {
+		return incoming.Price >= resting.Price
+	}
+	return incoming.Price <= resting.Price
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
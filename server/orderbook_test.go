@@ -0,0 +1,109 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// fillSummary identifies the orders in a Fill by ID, since the orders
+// themselves change as they're filled.
+type fillSummary struct {
+	BidID, AskID int64
+	Price        float64
+	Quantity     int64
+}
+
+func summarizeFills(fills []Fill) []fillSummary {
+	var summaries []fillSummary
+	for _, f := range fills {
+		summaries = append(summaries, fillSummary{f.Bid.ID, f.Ask.ID, f.Price, f.Quantity})
+	}
+	return summaries
+}
+
+func TestOrderBookPriceTimePriority(t *testing.T) {
+	alice := &TestUser{name: "Alice"}
+	bob := &TestUser{name: "Bob"}
+	carol := &TestUser{name: "Carol"}
+	dave := &TestUser{name: "Dave"}
+
+	b := NewOrderBook()
+	asks := []*Order{
+		{ID: 1, Owner: alice, Side: AskSide, Price: 12, Quantity: 5},
+		{ID: 2, Owner: bob, Side: AskSide, Price: 10, Quantity: 3},
+		{ID: 3, Owner: carol, Side: AskSide, Price: 10, Quantity: 4},
+	}
+	for _, o := range asks {
+		if fills := b.Place(o); len(fills) != 0 {
+			t.Fatalf("b.Place(%v) filled against asks: %v", o.ID, fills)
+		}
+	}
+
+	// The cheapest asks fill first, and Bob's before Carol's since it was
+	// placed first. The bid doesn't reach Alice's price.
+	bid := &Order{ID: 4, Owner: dave, Side: BidSide, Price: 11, Quantity: 9}
+	fills := b.Place(bid)
+	want := []fillSummary{
+		{BidID: 4, AskID: 2, Price: 10, Quantity: 3},
+		{BidID: 4, AskID: 3, Price: 10, Quantity: 4},
+	}
+	if diff := cmp.Diff(want, summarizeFills(fills)); diff != "" {
+		t.Errorf("Fills differ (-want +got):\n%v", diff)
+	}
+
+	bids, gotAsks := b.Depth()
+	if diff := cmp.Diff([]PriceLevel{{Price: 11, Quantity: 2}}, bids); diff != "" {
+		t.Errorf("Bid depth differs (-want +got):\n%v", diff)
+	}
+	if diff := cmp.Diff([]PriceLevel{{Price: 12, Quantity: 5}}, gotAsks); diff != "" {
+		t.Errorf("Ask depth differs (-want +got):\n%v", diff)
+	}
+
+	// A sell order fills at the resting bid's price.
+	ask := &Order{ID: 5, Owner: bob, Side: AskSide, Price: 9, Quantity: 1}
+	fills = b.Place(ask)
+	want = []fillSummary{{BidID: 4, AskID: 5, Price: 11, Quantity: 1}}
+	if diff := cmp.Diff(want, summarizeFills(fills)); diff != "" {
+		t.Errorf("Fills differ (-want +got):\n%v", diff)
+	}
+}
+
+func TestOrderBookDepthAggregatesPrices(t *testing.T) {
+	u := &TestUser{}
+	b := NewOrderBook()
+	b.Place(&Order{ID: 1, Owner: u, Side: BidSide, Price: 5, Quantity: 1})
+	b.Place(&Order{ID: 2, Owner: u, Side: BidSide, Price: 7, Quantity: 2})
+	b.Place(&Order{ID: 3, Owner: u, Side: BidSide, Price: 5, Quantity: 3})
+
+	bids, asks := b.Depth()
+	want := []PriceLevel{{Price: 7, Quantity: 2}, {Price: 5, Quantity: 4}}
+	if diff := cmp.Diff(want, bids); diff != "" {
+		t.Errorf("Bid depth differs (-want +got):\n%v", diff)
+	}
+	if len(asks) != 0 {
+		t.Errorf("Ask depth = %v, want none", asks)
+	}
+}
+
+func TestOrderBookRemove(t *testing.T) {
+	alice := &TestUser{name: "Alice"}
+	bob := &TestUser{name: "Bob"}
+	b := NewOrderBook()
+	b.Place(&Order{ID: 1, Owner: alice, Side: BidSide, Price: 5, Quantity: 1})
+	b.Place(&Order{ID: 2, Owner: bob, Side: AskSide, Price: 7, Quantity: 1})
+	b.Place(&Order{ID: 3, Owner: alice, Side: AskSide, Price: 8, Quantity: 1})
+
+	if _, ok := b.Cancel(2); !ok {
+		t.Errorf("b.Cancel(2) didn't find the order")
+	}
+	if _, ok := b.Cancel(2); ok {
+		t.Errorf("b.Cancel(2) found the order twice")
+	}
+	if removed := b.Remove(alice); len(removed) != 2 {
+		t.Errorf("b.Remove(alice) removed %v orders, want 2", len(removed))
+	}
+	if orders := b.Clear(); len(orders) != 0 {
+		t.Errorf("b.Clear() = %v, want an empty book", orders)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// GameIdleTimeout is how long a game can go without any players before
+	// it is torn down.
+	GameIdleTimeout time.Duration = 5 * time.Minute
+
+	// DefaultMaxGames is the default limit on the number of games which can
+	// be running at the same time.
+	DefaultMaxGames int = 100
+
+	// maxNameAttempts is how many random names are tried before giving up
+	// on finding one that isn't already in use.
+	maxNameAttempts int = 100
+)
+
+var (
+	// ErrGameExists is returned when creating a game whose name is taken.
+	ErrGameExists = errors.New("A game with that name already exists")
+	// ErrTooManyGames is returned when no more games can be created.
+	ErrTooManyGames = errors.New("Too many games in progress")
+	// ErrShuttingDown is returned once the registry has been shut down.
+	ErrShuttingDown = errors.New("The server is shutting down")
+	// errNoUnusedName is returned when random names keep colliding.
+	errNoUnusedName = errors.New("Unable to find an unused game name")
+)
+
+// GameRegistry keeps track of all of the games currently in progress. It is
+// safe to use from multiple threads, e.g. concurrent HTTP handlers.
+type GameRegistry struct {
+	mu       sync.Mutex
+	games    map[string]*GameServer
+	maxGames int
+
+	// Every game is stopped when ctx is cancelled.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewGameRegistry constructs an empty registry which allows at most maxGames
+// games to run at the same time. The games run until ctx is cancelled or the
+// registry is shut down.
+func NewGameRegistry(ctx context.Context, maxGames int) *GameRegistry {
+	r := &GameRegistry{
+		games:    make(map[string]*GameServer),
+		maxGames: maxGames,
+	}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	return r
+}
+
+// Lookup returns the game with the given name, if it exists.
+func (r *GameRegistry) Lookup(name string) (*GameServer, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	game, ok := r.games[name]
+	return game, ok
+}
+
+// Create starts a new game with the given name and rules. It fails if a game
+// with that name already exists, or if there are already too many games.
+func (r *GameRegistry) Create(name string, config GameConfig) (*GameServer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.games[name]; ok {
+		return nil, ErrGameExists
+	}
+	return r.create(name, config)
+}
+
+// LookupOrCreate returns the game with the given name, starting a new one if
+// it doesn't exist yet. The config is only used if a new game is started.
+func (r *GameRegistry) LookupOrCreate(name string, config GameConfig) (*GameServer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if game, ok := r.games[name]; ok {
+		return game, nil
+	}
+	return r.create(name, config)
+}
+
+// CreateWithRandomName starts a new game with a generated name which isn't
+// used by any game in progress.
+func (r *GameRegistry) CreateWithRandomName(config GameConfig) (*GameServer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := 0; i < maxNameAttempts; i++ {
+		name := GenerateGameName()
+		if _, ok := r.games[name]; !ok {
+			return r.create(name, config)
+		}
+	}
+	return nil, errNoUnusedName
+}
+
+// create must be called with the lock held.
+func (r *GameRegistry) create(name string, config GameConfig) (*GameServer, error) {
+	if r.ctx.Err() != nil {
+		return nil, ErrShuttingDown
+	}
+	if len(r.games) >= r.maxGames {
+		return nil, ErrTooManyGames
+	}
+
+	log.Printf("Creating game %q", name)
+	game := NewGameServer(r.ctx, name, config, r)
+	r.games[name] = game
+	return game, nil
+}
+
+// Delete removes the game from the registry and stops it. It does nothing if
+// the game isn't the one registered under its name.
+func (r *GameRegistry) Delete(game *GameServer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := game.Name()
+	if r.games[name] != game {
+		return
+	}
+	log.Printf("Deleting game %q", name)
+	delete(r.games, name)
+	game.Stop()
+}
+
+// Games returns every game in progress, sorted by name.
+func (r *GameRegistry) Games() []*GameServer {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	games := make([]*GameServer, 0, len(r.games))
+	for _, game := range r.games {
+		games = append(games, game)
+	}
+	sort.Slice(games, func(i, j int) bool {
+		return games[i].Name() < games[j].Name()
+	})
+	return games
+}
+
+// Len returns the number of games in progress.
+func (r *GameRegistry) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return len(r.games)
+}
+
+// Shutdown stops every game, and waits until each of them has said goodbye to
+// its players. No new games can be created afterwards.
+func (r *GameRegistry) Shutdown() {
+	r.mu.Lock()
+	r.cancel()
+	games := make([]*GameServer, 0, len(r.games))
+	for name, game := range r.games {
+		games = append(games, game)
+		delete(r.games, name)
+	}
+	r.mu.Unlock()
+
+	for _, game := range games {
+		<-game.Done()
+	}
+}
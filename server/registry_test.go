@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	r := NewGameRegistry(context.Background(), 2)
+
+	a, err := r.LookupOrCreate("a", DefaultGameConfig())
+	if err != nil {
+		t.Fatalf("r.LookupOrCreate(\"a\") failed: %v", err)
+	}
+	defer a.Stop()
+	if got, err := r.LookupOrCreate("a", DefaultGameConfig()); err != nil || got != a {
+		t.Errorf("r.LookupOrCreate(\"a\") = %v, %v, want the existing game", got, err)
+	}
+	if _, err := r.Create("a", DefaultGameConfig()); err == nil {
+		t.Errorf("r.Create(\"a\") succeeded for an existing game")
+	}
+
+	b, err := r.Create("b", DefaultGameConfig())
+	if err != nil {
+		t.Fatalf("r.Create(\"b\") failed: %v", err)
+	}
+	if _, err := r.Create("c", DefaultGameConfig()); err == nil {
+		t.Errorf("r.Create(\"c\") succeeded with too many games")
+	}
+
+	r.Delete(b)
+	if _, ok := r.Lookup("b"); ok {
+		t.Errorf("r.Lookup(\"b\") found a deleted game")
+	}
+	if b.AddPlayer(NewPlayer("p", "", false, nil)) {
+		t.Errorf("b.AddPlayer() succeeded after the game was stopped")
+	}
+	if _, err := r.Create("c", DefaultGameConfig()); err != nil {
+		t.Errorf("r.Create(\"c\") failed after a game was deleted: %v", err)
+	}
+	if got := r.Len(); got != 2 {
+		t.Errorf("r.Len() = %v, want 2", got)
+	}
+}
+
+func TestIdleGamesAreDeleted(t *testing.T) {
+	r := NewGameRegistry(context.Background(), 1)
+	s := &GameServer{registry: r}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	s.game = NewGame("idle", s, DefaultGameConfig())
+	r.games["idle"] = s
+
+	p := NewPlayer("p", "", false, nil)
+	s.players = []*Player{p}
+	s.game.RecieveMessage(p, NewJoinMessage())
+
+	// The game isn't idle while somebody is playing.
+	s.game.Tick(GameIdleTimeout)
+	s.checkIdle()
+	if _, ok := r.Lookup("idle"); !ok {
+		t.Fatalf("Game was deleted while it had players")
+	}
+
+	s.removePlayer(p)
+	s.game.Tick(GameIdleTimeout + GameIdleTimeout/2)
+	s.checkIdle()
+	if _, ok := r.Lookup("idle"); !ok {
+		t.Fatalf("Game was deleted before the idle timeout")
+	}
+
+	s.game.Tick(2 * GameIdleTimeout)
+	s.checkIdle()
+	if _, ok := r.Lookup("idle"); ok {
+		t.Errorf("Game wasn't deleted after the idle timeout")
+	}
+	select {
+	case <-s.ctx.Done():
+	default:
+		t.Errorf("Game wasn't stopped after the idle timeout")
+	}
+}
+
+func TestRegistryShutdown(t *testing.T) {
+	r := NewGameRegistry(context.Background(), 2)
+	a, err := r.Create("a", DefaultGameConfig())
+	if err != nil {
+		t.Fatalf("r.Create(\"a\") failed: %v", err)
+	}
+
+	r.Shutdown()
+	select {
+	case <-a.Done():
+	default:
+		t.Errorf("Game didn't finish during shutdown")
+	}
+	if got := r.Len(); got != 0 {
+		t.Errorf("r.Len() = %v after shutdown, want 0", got)
+	}
+	if _, err := r.Create("b", DefaultGameConfig()); err == nil {
+		t.Errorf("r.Create(\"b\") succeeded after shutdown")
+	}
+}
+
+func TestGameNames(t *testing.T) {
+	rand.Seed(1)
+	r := NewGameRegistry(context.Background(), 50)
+	defer r.Shutdown()
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		game, err := r.CreateWithRandomName(DefaultGameConfig())
+		if err != nil {
+			t.Fatalf("r.CreateWithRandomName(DefaultGameConfig()) failed: %v", err)
+		}
+		name := game.Name()
+		if seen[name] {
+			t.Errorf("Game name %q was used twice", name)
+		}
+		seen[name] = true
+		if parts := strings.Split(name, "-"); len(parts) != 3 {
+			t.Errorf("Game name %q isn't of the form word-commodity-number", name)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sort"
+)
+
+// roundStats records what each player did during the current round, so that
+// it can be summarised when the round is over.
+type roundStats struct {
+	players     map[User]*RoundPlayerSummary
+	startPrices map[CommodityType]float64
+}
+
+func newRoundStats(prices map[CommodityType]float64) *roundStats {
+	return &roundStats{
+		players:     make(map[User]*RoundPlayerSummary),
+		startPrices: prices,
+	}
+}
+
+// player returns the summary for a user, starting a new one if needed.
+func (r *roundStats) player(u User) *RoundPlayerSummary {
+	p, ok := r.players[u]
+	if !ok {
+		p = &RoundPlayerSummary{Purchases: []AuctionPurchase{}}
+		r.players[u] = p
+	}
+	return p
+}
+
+// beginRound starts counting a new round. The market moves on between
+// rounds, so that prices recover from the selling in the last round.
+func (g *Game) beginRound() {
+	if g.Round == 0 {
+		g.startedAt = g.tick
+	} else {
+		g.Market.Evolve(g.Config.SupplyRecovery, g.Config.DemandDrift, g.rand)
+		g.connection.Broadcast(NewPriceUpdatedMessage(g.Market))
+	}
+	g.Round++
+	g.stats = newRoundStats(g.Market.Prices())
+}
+
+// recordSale notes that a user earned money by selling goods.
+func (g *Game) recordSale(u User, amount float64) {
+	g.stats.player(u).Earnings += amount
+}
+
+// recordPurchase notes that a user won a card at auction.
+func (g *Game) recordPurchase(u User, card Card, price int) {
+	p := g.stats.player(u)
+	p.Purchases = append(p.Purchases, AuctionPurchase{
+		Card:  card.Name,
+		Price: price,
+	})
+}
+
+// recordTrade notes that a user completed a trade with another player.
+func (g *Game) recordTrade(u User) {
+	g.stats.player(u).Trades++
+}
+
+// RoundSummary describes what happened during the current round.
+func (g *Game) RoundSummary() Message {
+	var players []RoundPlayerSummary
+	for _, u := range g.Ledger.Users() {
+		p := *g.stats.player(u)
+		p.Name = u.Name()
+		players = append(players, p)
+	}
+	sort.Slice(players, func(i, j int) bool {
+		return players[i].Name < players[j].Name
+	})
+
+	prices := make(map[CommodityType]PriceMovement)
+	for t, end := range g.Market.Prices() {
+		prices[t] = PriceMovement{
+			Start: g.stats.startPrices[t],
+			End:   end,
+		}
+	}
+
+	return NewRoundSummaryMessage(g.Round, players, prices)
+}
@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
 	"log"
+	mathrand "math/rand"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -11,12 +17,32 @@ const (
 	// TickInterval is the nominal time between ticks. All timing is done in
 	// increments of the TickInterval. It's kind of like the frame rate.
 	TickInterval time.Duration = 300 * time.Millisecond
+
+	// ReconnectGracePeriod is how long a player's seat is kept after their
+	// connection drops. If they reconnect with their session token within
+	// this time, they resume where they left off.
+	ReconnectGracePeriod time.Duration = 30 * time.Second
 )
 
-// Player is an implementation of User with websockets.
+// Player is an implementation of User with websockets. The Connection is nil
+// while the player is disconnected.
 type Player struct {
-	name       string
-	Connection *websocket.Conn
+	name           string
+	admin          bool
+	session        string
+	disconnectedAt time.Duration
+	Connection     *websocket.Conn
+}
+
+// NewPlayer constructs a player. The session is the token which the player
+// presented when joining, if any, which lets them resume a dropped seat.
+func NewPlayer(name, session string, admin bool, conn *websocket.Conn) *Player {
+	return &Player{
+		name:       name,
+		admin:      admin,
+		session:    session,
+		Connection: conn,
+	}
 }
 
 func (p *Player) Name() string {
@@ -27,15 +53,47 @@ func (p *Player) SetName(name string) {
 	p.name = name
 }
 
+// Origin returns the privileges that the player's messages are sent with.
+func (p *Player) Origin() MessageOrigin {
+	if p.admin {
+		return AdminOrigin
+	}
+	return ClientOrigin
+}
+
 // Message sends a player a message.
 func (p *Player) Message(message Message) error {
+	if p.Connection == nil {
+		return fmt.Errorf("Player %q is disconnected", p.name)
+	}
 	return p.Connection.WriteJSON(message)
 }
 
+// GenerateSessionToken generates a random token which a player can use to
+// resume their seat if their connection drops.
+func GenerateSessionToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// GameNameWords are combined with the names of the commodities to make game
+// names. They're short and easy to say out loud, so that a game name can be
+// read off one phone and typed into another.
+var GameNameWords = []string{
+	"happy", "sunny", "rusty", "golden", "crispy", "juicy", "muddy", "sleepy",
+	"lucky", "shiny", "windy", "dusty", "frosty", "rainy", "spicy", "fuzzy",
+}
+
 // GenerateGameName generates a random name for the game, in case
-// the user didn't specify one when they connected.
+// the user didn't specify one when they connected, e.g. "sunny-corn-42".
+// The name isn't necessarily unique; see GameRegistry.CreateWithRandomName.
 func GenerateGameName() string {
-	return "test"
+	word := GameNameWords[mathrand.Intn(len(GameNameWords))]
+	commodity := AllCommodities[mathrand.Intn(len(AllCommodities))].ID
+	return fmt.Sprintf("%v-%v-%v", word, commodity, 10+mathrand.Intn(90))
 }
 
 // An Event is a combination of a Message and the Player who originated the
@@ -45,6 +103,19 @@ type Event struct {
 	Player  *Player
 }
 
+// DisconnectMessage is generated internally when a player's connection
+// drops. The connection is recorded so that a late error from a connection
+// that has since been replaced can be ignored.
+type DisconnectMessage struct {
+	connection *websocket.Conn
+}
+
+// infoRequest is generated internally to ask the game thread to describe the
+// game. The description is sent back on the reply channel.
+type infoRequest struct {
+	reply chan GameInfo
+}
+
 // NewEvent constructs an Event.
 func NewEvent(player *Player, message Message) Event {
 	return Event{
@@ -55,15 +126,58 @@ func NewEvent(player *Player, message Message) Event {
 
 // A GameServer is an instance of a GameConnection.
 type GameServer struct {
-	players          []Player
+	players          []*Player
 	game             *Game
 	incomingMessages chan Event
+
+	// registry is told when the game has been empty for longer than the
+	// GameIdleTimeout. It may be nil, in which case the game runs forever.
+	registry   *GameRegistry
+	emptySince time.Duration
+
+	// ctx is cancelled when the game is stopped, which shuts down all of the
+	// game's threads. done is closed once the game thread has said goodbye
+	// to every player.
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Name returns the name of the game.
+func (s *GameServer) Name() string {
+	return s.game.name
+}
+
+// Stop shuts down the game's threads. It is safe to call more than once, and
+// from any thread, and returns without waiting for the threads to finish.
+func (s *GameServer) Stop() {
+	s.cancel()
 }
 
-// Broadcast sends a message to every Player.
+// Done returns a channel which is closed once the game has shut down and
+// closed every player's connection.
+func (s *GameServer) Done() <-chan struct{} {
+	return s.done
+}
+
+// send queues an event for the game thread. It returns false if the game has
+// been stopped, in which case the event is dropped.
+func (s *GameServer) send(event Event) bool {
+	select {
+	case s.incomingMessages <- event:
+		return true
+	case <-s.ctx.Done():
+		return false
+	}
+}
+
+// Broadcast sends a message to every connected Player.
 func (s *GameServer) Broadcast(message Message) error {
 	log.Printf("Broadcast: %v", message)
 	for _, p := range s.players {
+		if p.Connection == nil {
+			continue
+		}
 		err := p.Message(message)
 		if err != nil {
 			log.Printf("Write failed during broadcast: %v\n", err)
@@ -74,24 +188,23 @@ func (s *GameServer) Broadcast(message Message) error {
 
 // AddPlayer is called by the main thread to add a player to our game. In fact, it
 // queues a JoinMessage from this new player, which our game thread picks up.
-func (s *GameServer) AddPlayer(player Player) {
+// It returns false if the game has already been stopped.
+func (s *GameServer) AddPlayer(player *Player) bool {
 	log.Printf("Adding new player %q to game %q", player.Name(), s.game.name)
 
-	s.incomingMessages <- NewEvent(&player, NewJoinMessage())
+	return s.send(NewEvent(player, NewJoinMessage()))
 }
 
-// HandleCommunication is the main game loop which reads messages from players.
-// This thread is where all of the game state logic is called from, including
-// timer callbacks, etc.
-func (s *GameServer) HandleCommunication(player Player) {
-	// Send a join message as we arrive.
-	s.incomingMessages <- NewEvent(&player, NewJoinMessage())
-
+// HandleCommunication reads messages from a player's connection and sends them
+// over to the game thread to be handled. It is called on a new thread each
+// time that a player connects, and returns once the connection is closed or
+// the game is stopped.
+func (s *GameServer) HandleCommunication(player *Player, conn *websocket.Conn) {
 	for {
-		t, data, err := player.Connection.ReadMessage()
+		t, data, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Websocket[name=%v] read error: %v", player.Name(), err)
-			s.incomingMessages <- NewEvent(&player, NewLeaveMessage())
+			s.send(NewEvent(player, DisconnectMessage{conn}))
 			return
 		}
 
@@ -99,66 +212,253 @@ func (s *GameServer) HandleCommunication(player Player) {
 			log.Printf("Websocket[name=%v] sent binary message", player.Name())
 		}
 
+		// Players may only send the actions that they're permitted to, which
+		// is only checked once the action is known to exist. Rejections are
+		// sent back through the game thread, since that's the only thread
+		// which writes to the connection.
+		basic, _ := DecodeBasicMessage(data)
 		msg, err := DecodeMessage(data)
-		log.Printf("Player[name=%v] sent message: %v", player.Name(), msg)
+		if err == nil {
+			err = CheckOrigin(MessageAction(basic.Action), player.Origin())
+		}
 		if err != nil {
 			log.Printf("Websocket[name=%v] sent invalid message: %v", player.Name(), err)
+			if !s.send(NewEvent(player, NewErrorMessage(basic, err))) {
+				return
+			}
+			continue
+		}
+		log.Printf("Player[name=%v] sent message: %v", player.Name(), msg)
+		if !s.send(NewEvent(player, msg)) {
+			return
 		}
-		s.incomingMessages <- NewEvent(&player, msg)
 	}
 }
 
-// HandleMessages is called on a new thread, once for each Player. It simply gets
-// messages from the Player and sends them over to the game thread to be handled.
+// HandleMessages is the main game loop, which handles messages from all of the
+// players. This thread is where all of the game state logic is called from,
+// including timer callbacks, etc. It returns once the game is stopped.
 func (s *GameServer) HandleMessages() {
+	defer close(s.done)
 	for {
-		event := <-s.incomingMessages
+		var event Event
+		select {
+		case event = <-s.incomingMessages:
+		case <-s.ctx.Done():
+			s.closeConnections()
+			return
+		}
+
 		switch msg := event.Message.(type) {
 		case TickMessage:
 			s.game.Tick(time.Duration(msg.Tick) * time.Millisecond)
+			s.expireDisconnectedPlayers()
+			s.checkIdle()
 		case JoinMessage:
-			new := true
-			for _, x := range s.players {
-				if *event.Player == x {
-					new = false
-					break
-				}
+			if existing := s.findSession(event.Player.session); existing != nil {
+				s.resume(existing, event.Player.Connection)
+				break
 			}
 
-			if new {
-				// On the first pass, set up the player and begin handling
-				// their messages for them.
-				s.players = append(s.players, *event.Player)
-				go s.HandleCommunication(*event.Player)
-			} else {
-				// On subsequent passes, we just want to send the message
-				// through to the game controller.
-				s.game.RecieveMessage(event.Player, event.Message)
+			// Set up the new player and begin handling their messages.
+			player := event.Player
+			player.session = GenerateSessionToken()
+			s.players = append(s.players, player)
+			go s.HandleCommunication(player, player.Connection)
+
+			player.Message(NewSessionMessage(player.session))
+			s.game.RecieveMessage(player, msg)
+		case DisconnectMessage:
+			if event.Player.Connection != msg.connection {
+				// The player has already reconnected on a new connection.
+				break
 			}
+			log.Printf("Player %q disconnected from game %q",
+				event.Player.Name(), s.game.name)
+			event.Player.Connection = nil
+			event.Player.disconnectedAt = s.game.GetTime()
+		case LeaveMessage:
+			// The player has quit the game on purpose, so there's no need
+			// to keep their seat.
+			s.removePlayer(event.Player)
+		case infoRequest:
+			msg.reply <- s.info()
+		case ErrorMessage:
+			// Errors are generated by the server, and only need to be passed
+			// on to the player who caused them.
+			event.Player.Message(msg)
 		default:
 			s.game.RecieveMessage(event.Player, event.Message)
 		}
 	}
 }
 
+// Info describes the game for the lobby. It can be called from any thread,
+// and returns false if the game has been stopped.
+func (s *GameServer) Info() (GameInfo, bool) {
+	// The reply is buffered so that the game thread never waits for us.
+	reply := make(chan GameInfo, 1)
+	if !s.send(NewEvent(nil, infoRequest{reply})) {
+		return GameInfo{}, false
+	}
+	select {
+	case info := <-reply:
+		return info, true
+	case <-s.ctx.Done():
+		return GameInfo{}, false
+	}
+}
+
+// info must be called from the game thread.
+func (s *GameServer) info() GameInfo {
+	info := GameInfo{
+		Name:        s.game.name,
+		State:       string(s.game.state.Name()),
+		PlayerCount: len(s.players),
+		Config:      s.game.Config,
+		Players:     []LobbyPlayer{},
+	}
+	for _, p := range s.players {
+		info.Players = append(info.Players, LobbyPlayer{
+			Name:      p.Name(),
+			Connected: p.Connection != nil,
+		})
+	}
+	return info
+}
+
+// findSession returns the player holding the session token, or nil if there
+// isn't one.
+func (s *GameServer) findSession(session string) *Player {
+	if session == "" {
+		return nil
+	}
+	for _, p := range s.players {
+		if subtle.ConstantTimeCompare(
+			[]byte(p.session), []byte(session)) == 1 {
+			return p
+		}
+	}
+	return nil
+}
+
+// resume re-attaches a player to a new connection, and brings them up to date
+// with the state of the game.
+func (s *GameServer) resume(player *Player, conn *websocket.Conn) {
+	log.Printf("Player %q resumed their seat in game %q", player.Name(), s.game.name)
+
+	if player.Connection != nil {
+		// The player has connected again without the old connection being
+		// dropped, e.g. from a new tab. Only the newest connection is kept.
+		player.Connection.Close()
+	}
+	player.Connection = conn
+	go s.HandleCommunication(player, conn)
+
+	player.Message(NewSessionMessage(player.session))
+	s.game.RecieveMessage(player, NewResumeMessage())
+}
+
+// expireDisconnectedPlayers gives up on players who have been disconnected for
+// longer than the ReconnectGracePeriod.
+func (s *GameServer) expireDisconnectedPlayers() {
+	var expired []*Player
+	for _, p := range s.players {
+		if p.Connection == nil && s.game.GetTime()-p.disconnectedAt >= ReconnectGracePeriod {
+			expired = append(expired, p)
+		}
+	}
+	for _, p := range expired {
+		s.removePlayer(p)
+	}
+}
+
+// removePlayer removes a player from the game for good, closing their
+// connection, and lets the game know that they've left.
+func (s *GameServer) removePlayer(player *Player) {
+	found := false
+	for i, p := range s.players {
+		if p == player {
+			s.players = append(s.players[:i], s.players[i+1:]...)
+			found = true
+			break
+		}
+	}
+	if !found {
+		return
+	}
+
+	log.Printf("Removing player %q from game %q", player.Name(), s.game.name)
+	if player.Connection != nil {
+		player.Connection.Close()
+		player.Connection = nil
+	}
+	s.game.RecieveMessage(player, NewLeaveMessage())
+
+	if len(s.players) == 0 {
+		s.emptySince = s.game.GetTime()
+	}
+}
+
+// checkIdle tears the game down if nobody has been playing it for longer than
+// the GameIdleTimeout.
+func (s *GameServer) checkIdle() {
+	if s.registry == nil || len(s.players) > 0 {
+		return
+	}
+	if s.game.GetTime()-s.emptySince >= GameIdleTimeout {
+		log.Printf("Game %q is idle", s.game.name)
+		s.registry.Delete(s)
+	}
+}
+
+// closeConnections tells every connected player that the game is over, and
+// closes their connections. Closing the connections stops the threads which
+// read from them.
+func (s *GameServer) closeConnections() {
+	log.Printf("Closing game %q", s.game.name)
+	s.Broadcast(NewGameClosedMessage("The game has been shut down"))
+	for _, p := range s.players {
+		if p.Connection != nil {
+			p.Connection.Close()
+			p.Connection = nil
+		}
+	}
+}
+
 // RunClock is a dedicated thread which sends tick messages at the TickInterval.
+// It returns once the game is stopped.
 func (s *GameServer) RunClock() {
+	ticker := time.NewTicker(TickInterval)
+	defer ticker.Stop()
+
 	ticks := 0 * time.Second
 	for {
-		time.Sleep(TickInterval)
+		select {
+		case <-ticker.C:
+		case <-s.ctx.Done():
+			return
+		}
 		ticks += TickInterval
-		s.incomingMessages <- NewEvent(nil, NewTickMessage(ticks))
+		if !s.send(NewEvent(nil, NewTickMessage(ticks))) {
+			return
+		}
 	}
 }
 
 // NewGameServer constructs a game server object, initializes the threads which it
-// needs to handle messages and the game clock.
-func NewGameServer(name string) *GameServer {
+// needs to handle messages and the game clock. The threads run until the game
+// is stopped or ctx is cancelled. The registry is told when the game becomes
+// idle, and may be nil.
+func NewGameServer(ctx context.Context, name string, config GameConfig, registry *GameRegistry) *GameServer {
 	g := GameServer{
 		game:             nil,
 		incomingMessages: make(chan Event),
+		registry:         registry,
+		done:             make(chan struct{}),
 	}
-	g.game = NewGame(name, &g)
+	g.ctx, g.cancel = context.WithCancel(ctx)
+	g.game = NewGame(name, &g, config)
 
 	go g.HandleMessages()
 	go g.RunClock()
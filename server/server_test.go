@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialGame joins a player to a game through the test server, in the same way
+// as the app does.
+func dialGame(t *testing.T, server *httptest.Server, game, name string) *websocket.Conn {
+	params := url.Values{"game": {game}, "name": {name}}
+	u := "ws" + strings.TrimPrefix(server.URL, "http") + "/join?" + params.Encode()
+	conn, _, err := websocket.DefaultDialer.Dial(u, nil)
+	if err != nil {
+		t.Fatalf("Unable to join game %q: %v", game, err)
+	}
+	return conn
+}
+
+// awaitMessage reads messages from the connection until one with the given
+// action arrives, and returns it.
+func awaitMessage(t *testing.T, conn *websocket.Conn, action MessageAction) []byte {
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, data, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("Connection closed while waiting for %q: %v", action, err)
+		}
+		var basic BasicMessage
+		if json.Unmarshal(data, &basic) == nil && basic.Action == string(action) {
+			return data
+		}
+	}
+}
+
+func TestFindSession(t *testing.T) {
+	s := &GameServer{}
+	s.game = NewGame("g", s, DefaultGameConfig())
+	a := NewPlayer("a", "token-a", false, nil)
+	b := NewPlayer("b", "token-b", false, nil)
+	s.players = []*Player{a, b}
+
+	if got := s.findSession("token-b"); got != b {
+		t.Errorf("s.findSession(\"token-b\") = %v, want %v", got, b)
+	}
+	if got := s.findSession("token-c"); got != nil {
+		t.Errorf("s.findSession(\"token-c\") = %v, want nil", got)
+	}
+	if got := s.findSession(""); got != nil {
+		t.Errorf("s.findSession(\"\") = %v, want nil", got)
+	}
+
+	// Players who have left can't be resumed.
+	s.removePlayer(b)
+	if got := s.findSession("token-b"); got != nil {
+		t.Errorf("s.findSession(\"token-b\") = %v, want nil", got)
+	}
+}
+
+func TestDisconnectedPlayersExpire(t *testing.T) {
+	// A second player is needed, so getting ready doesn't start the game.
+	config := DefaultGameConfig()
+	config.MinPlayers = 2
+	s := &GameServer{}
+	s.game = NewGame("g", s, config)
+
+	// The player drops straight after getting ready. Their seat, including
+	// their ready status, is kept during the grace period.
+	p := NewPlayer("p", "token-p", false, nil)
+	s.players = []*Player{p}
+	s.game.RecieveMessage(p, NewJoinMessage())
+	s.game.RecieveMessage(p, NewReadyMessage(true))
+
+	s.game.Tick(ReconnectGracePeriod / 2)
+	s.expireDisconnectedPlayers()
+	if len(s.players) != 1 {
+		t.Errorf("Player left before the grace period expired")
+	}
+	ready := s.game.state.(*WaitingController).ready
+	if !ready[p] {
+		t.Errorf("Player lost their seat before the grace period expired")
+	}
+
+	s.game.Tick(ReconnectGracePeriod + 1)
+	s.expireDisconnectedPlayers()
+	if len(s.players) != 0 {
+		t.Errorf("Player didn't leave after the grace period expired")
+	}
+	if _, ok := ready[p]; ok {
+		t.Errorf("Player kept their seat after the grace period expired")
+	}
+}
+
+func TestPlayerMessagesAreChecked(t *testing.T) {
+	Games = NewGameRegistry(context.Background(), 1)
+	defer Games.Shutdown()
+	server := httptest.NewServer(http.HandlerFunc(join))
+	defer server.Close()
+	conn := dialGame(t, server, "farm", "p")
+	defer conn.Close()
+
+	tests := []struct {
+		message string
+		code    ErrorCode
+	}{
+		{`{"action": "activate_card"}`, UnknownActionError},
+		{`{"action": "apply_effect"}`, ForbiddenError},
+		{`{"action": "welcome"}`, ForbiddenError},
+		{`{"action": "tick", "tick": 1}`, ForbiddenError},
+		{`not json`, InvalidMessageError},
+	}
+
+	for _, test := range tests {
+		conn.WriteMessage(websocket.TextMessage, []byte(test.message))
+		var msg ErrorMessage
+		if err := json.Unmarshal(awaitMessage(t, conn, ErrorAction), &msg); err != nil {
+			t.Fatalf("Unable to decode error message: %v", err)
+		}
+		if msg.Code != string(test.code) {
+			t.Errorf("Sending %v gave error %q, want %q", test.message, msg.Code, test.code)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"math"
 	"math/rand"
 	"time"
 )
@@ -13,8 +14,11 @@ const (
 	ProductionState GameState = "production"
 	AuctionState    GameState = "auction"
 	TradeState      GameState = "trade"
+	GameOverState   GameState = "game_over"
 )
 
+// The default rules of the game. Each game can be given its own rules with
+// a GameConfig.
 const (
 	// ProductionTimeout is how long the production phase will last before
 	// the next phase begins.
@@ -24,18 +28,59 @@ const (
 	AuctionBidTime time.Duration = 5 * time.Second
 	// The number of cards held up for auction.
 	NumberOfBids = 3
-	// TradingStageTime is how long the production phase will last before
+	// TradingStageTime is how long the trading phase will last before
 	// the next phase begins.
 	TradingStageTime time.Duration = 10 * time.Second
 	// TradeTimeout specifies how long a trade can hang without a
 	// counterpart before it is cancelled.
 	TradeTimeout time.Duration = 100 * time.Millisecond
+	// ProposalTime is how long players have to accept a proposed trade,
+	// when trades must be confirmed.
+	ProposalTime time.Duration = 10 * time.Second
 
 	// MinPlayers sets the minimum number of players required before the game
 	// will proceed past the Waiting stage.
 	MinPlayers int = 1
+
+	// SupplyRecovery is the fraction of surplus supply which the market
+	// consumes between rounds.
+	SupplyRecovery float64 = 0.5
+	// DemandDrift is the standard deviation of the (logarithmic) random walk
+	// which demand takes between rounds.
+	DemandDrift float64 = 0.1
 )
 
+// PhaseActions lists the states in which each action may be taken. Actions
+// which aren't listed may be taken at any time.
+var PhaseActions = map[MessageAction][]GameState{
+	ReadyAction: {WaitingState},
+	PlantAction: {ProductionState},
+	BidAction:   {AuctionState},
+	TradeAction: {TradeState},
+	SellAction:  {TradeState},
+	BuyAction:   {TradeState},
+
+	PlaceOrderAction:   {TradeState},
+	CancelOrderAction:  {TradeState},
+	TradeAcceptAction:  {TradeState},
+	TradeDeclineAction: {TradeState},
+}
+
+// CheckPhase returns an error if the action can't be taken in the state.
+func CheckPhase(action MessageAction, state GameState) error {
+	states, ok := PhaseActions[action]
+	if !ok {
+		return nil
+	}
+	for _, s := range states {
+		if s == state {
+			return nil
+		}
+	}
+	return NewGameError(WrongPhaseError,
+		"Can't %v during the %v phase", action, state)
+}
+
 type StateController interface {
 	Name() GameState
 	Begin()
@@ -44,6 +89,12 @@ type StateController interface {
 	RecieveMessage(User, Message)
 }
 
+// A Ticker is a StateController which needs to hear about every tick of the
+// game clock, not just the timeouts that it sets.
+type Ticker interface {
+	Tick(tick time.Duration)
+}
+
 type WaitingController struct {
 	game  *Game
 	name  GameState
@@ -80,6 +131,9 @@ func (s *WaitingController) RecieveMessage(u User, m Message) {
 		s.ready[u] = false
 	case LeaveMessage:
 		delete(s.ready, u)
+	case ResumeMessage:
+		// The player keeps their ready status, but needs to know about
+		// everybody else's.
 	case SetNameMessage:
 		// Just send a playerinfo update (done below),
 		// no need to take action, since
@@ -110,20 +164,22 @@ func (s *WaitingController) proceedIfReady() {
 		count++
 	}
 
-	if count >= s.game.MinPlayers {
+	if count >= s.game.Config.MinPlayers {
 		s.game.ChangeState(ProductionState)
 	}
 }
 
 type ProductionController struct {
-	game *Game
-	name GameState
+	game    *Game
+	name    GameState
+	planted map[User]CommodityType
 }
 
 func NewProductionController(game *Game) *ProductionController {
 	return &ProductionController{
-		game: game,
-		name: ProductionState,
+		game:    game,
+		name:    ProductionState,
+		planted: map[User]CommodityType{},
 	}
 }
 
@@ -131,36 +187,84 @@ func NewProductionController(game *Game) *ProductionController {
 func (s *ProductionController) Name() GameState { return s.name }
 
 // End is called when the state is no longer active.
-func (s *ProductionController) End()                             {}
-func (s *ProductionController) RecieveMessage(u User, m Message) {}
+func (s *ProductionController) End() {}
+
+// RecieveMessage is called when a user sends a message to the server.
+func (s *ProductionController) RecieveMessage(u User, m Message) {
+	switch msg := m.(type) {
+	case LeaveMessage:
+		delete(s.planted, u)
+	case PlantMessage:
+		t := CommodityType(msg.Type)
+		if _, ok := s.game.Market.Commodities[t]; !ok {
+			u.Message(NewErrorMessage(msg, NewGameError(
+				InvalidRequestError, "Invalid commodity type: %v", t)))
+			return
+		}
+		s.planted[u] = t
+	}
+}
 
 // Begin is called when the state becomes active.
 func (s *ProductionController) Begin() {
 	// The production stage is timed, so we should move to the next stage
 	// after the time interval.
-	s.game.connection.Broadcast(NewSetClockMessage(ProductionTimeout))
-	s.game.SetTimeout(ProductionTimeout)
+	timeout := milliseconds(s.game.Config.ProductionTime)
+	s.game.connection.Broadcast(NewSetClockMessage(timeout))
+	s.game.SetTimeout(timeout)
 }
 
-// Timer is called when the state ends, so just transition to the next state.
+// Timer is called when the state ends, so build the factories that were
+// planted, bring in the harvest and transition to the next state.
 func (s *ProductionController) Timer(tick time.Duration) {
+	for _, u := range s.game.Ledger.Users() {
+		account := s.game.Ledger.Account(u)
+		if t, ok := s.planted[u]; ok {
+			account.Factories[t]++
+		}
+
+		harvest := Harvest(account.Factories, s.game.Yield)
+		s.game.Ledger.Deposit(u, harvest)
+		u.Message(NewInventoryUpdatedMessage(account, harvest))
+	}
+
 	s.game.ChangeState(AuctionState)
 }
 
+// Harvest returns the materials produced by a set of factories. Each factory
+// yields, on average, the yield rate of its commodity. Fractional yield rates
+// are rounded up or down at random, so that a rate of 1.25 yields 2 a quarter
+// of the time and 1 the rest of the time.
+func Harvest(factories Materials, yield map[CommodityType]float64) Materials {
+	harvest := Materials{}
+	for t, count := range factories {
+		n := math.Floor(yield[t])
+		p := yield[t] - n
+		for i := int64(0); i < count; i++ {
+			harvest[t] += int64(n)
+			if rand.Float64() < p {
+				harvest[t]++
+			}
+		}
+	}
+	return harvest
+}
+
 type AuctionController struct {
 	name   GameState
 	game   *Game
-	bid    int
+	format AuctionFormat
+	card   Card
 	step   int
 	steps  int
-	winner User
 }
 
 func NewAuctionController(game *Game) *AuctionController {
 	return &AuctionController{
-		name:  AuctionState,
-		game:  game,
-		steps: NumberOfBids,
+		name:   AuctionState,
+		game:   game,
+		format: NewAuctionFormat(game),
+		steps:  game.Config.NumberOfBids,
 	}
 }
 
@@ -169,35 +273,62 @@ func (s *AuctionController) Name() GameState { return s.name }
 
 // Begin is called when the state becomes active.
 func (s *AuctionController) Begin() {
+	if s.steps == 0 {
+		// The game has been configured without auctions.
+		s.game.ChangeState(TradeState)
+		return
+	}
 	s.issueCard()
 }
 
 func (s *AuctionController) issueCard() {
-	// When the auction begins, we need to choose a random number and broadcast
-	// it to the participants.
-	seed := rand.Int()
-	s.game.connection.Broadcast(
-		NewAuctionSeedMessage(seed),
-	)
+	// When the auction begins, we need to draw a card from the deck and
+	// broadcast it to the participants.
+	card, ok := s.game.Deck.Draw()
+	if !ok {
+		log.Printf("No cards to auction in game %q", s.game.name)
+		s.game.ChangeState(TradeState)
+		return
+	}
+	s.card = card
+	s.game.connection.Broadcast(NewAuctionCardMessage(card))
+	s.setClock(s.format.Open(card))
+}
 
-	// Set a timeout, and update player clocks.
-	s.game.SetTimeout(AuctionBidTime)
-	s.game.connection.Broadcast(NewSetClockMessage(AuctionBidTime))
+// setClock sets a timeout, and updates player clocks.
+func (s *AuctionController) setClock(timeout time.Duration) {
+	s.game.SetTimeout(timeout)
+	s.game.connection.Broadcast(NewSetClockMessage(timeout))
 }
 
 // End is called when the state is no longer active.
 func (s *AuctionController) End() {}
 
-// Timer is only used to determine when the auction is over. So when we get
-// this call, the current auction is over.
+// Timer is called when the auction clock runs out, which is up to the format
+// to make sense of.
 func (s *AuctionController) Timer(tick time.Duration) {
-	if s.winner != nil {
-		s.winner.Message(NewAuctionWonMessage())
+	if next := s.format.Timer(); next != CloseAuction {
+		s.setClock(next)
+		return
 	}
+	s.closeAuction()
+}
 
-	// Reset the bid and winner.
-	s.bid = 0
-	s.winner = nil
+// closeAuction gives the current card to its winner, if it has one, and
+// moves on to the next card.
+func (s *AuctionController) closeAuction() {
+	if winner, price, bid := s.format.Result(); winner != nil {
+		// Bids are checked against the ledger when they're placed, so this
+		// can only fail if the winner's funds have changed since.
+		if err := s.game.Ledger.Debit(winner, float64(price)); err != nil {
+			log.Printf("Auction winner %q can't pay: %v", winner.Name(), err)
+			winner.Message(NewErrorMessage(bid, err))
+		} else {
+			winner.Message(NewAuctionWonMessage())
+			s.game.recordPurchase(winner, s.card, price)
+			s.game.ApplyEffects(s.card.Effect())
+		}
+	}
 
 	s.step++
 	if s.step == s.steps {
@@ -213,26 +344,33 @@ func (s *AuctionController) Timer(tick time.Duration) {
 // RecieveMessage is called when a new message is sent by a user.
 func (s *AuctionController) RecieveMessage(u User, m Message) {
 	switch msg := m.(type) {
+	case LeaveMessage:
+		s.format.Leave(u)
 	case BidMessage:
-		if msg.Amount > s.bid {
-			s.bid = msg.Amount
-			s.winner = u
-			s.game.SetTimeout(AuctionBidTime)
-
-			// Update everyone on the new bid and winner.
-			s.game.connection.Broadcast(NewBidUpdatedMessage(s.bid, u.Name()))
-			s.game.connection.Broadcast(NewSetClockMessage(AuctionBidTime))
+		next, err := s.format.Bid(u, msg)
+		if err != nil {
+			u.Message(NewErrorMessage(msg, err))
+			return
+		}
+		switch {
+		case next == CloseAuction:
+			s.closeAuction()
+		case next != KeepClock:
+			s.setClock(next)
 		}
 	}
 }
 
 // TradeController manages the state of the game during trading.
 type TradeController struct {
-	name            GameState
-	game            *Game
-	stagedMaterials string
-	stagedUser      User
-	stagingTime     time.Duration
+	name GameState
+	game *Game
+	// trades holds the bump offers which haven't been paired yet.
+	trades TradeQueue
+	// proposals are the paired offers waiting to be accepted, when trades
+	// must be confirmed, in the order they were proposed.
+	proposals      []*TradeProposal
+	nextProposalID int64
 }
 
 // NewTradeController creates a TradeController instance.
@@ -251,53 +389,381 @@ func (s *TradeController) Begin() {
 	// Should automatically update the prices at the beginning of the stage.
 	s.game.connection.Broadcast(NewPriceUpdatedMessage(s.game.Market))
 	// The trading stage ends after a certain time.
-	s.game.SetTimeout(TradingStageTime)
-	s.game.connection.Broadcast(NewSetClockMessage(TradingStageTime))
+	timeout := milliseconds(s.game.Config.TradingTime)
+	s.game.SetTimeout(timeout)
+	s.game.connection.Broadcast(NewSetClockMessage(timeout))
 }
 
-// Timer is called when the stage is over, so just begin next stage.
+// Timer is called when the stage is over, which is the end of the round. The
+// orders are cancelled first, so that whatever was held for them counts
+// towards the players' net worth when the round is summed up.
 func (s *TradeController) Timer(tick time.Duration) {
-	s.game.ChangeState(ProductionState)
+	s.End()
+	s.game.EndRound()
 }
 
-// End is called when the state is no longer active.
-func (s *TradeController) End() {}
+// Tick expires the bump offers which nobody has taken up in time, and the
+// proposals which haven't been accepted in time.
+func (s *TradeController) Tick(tick time.Duration) {
+	timeout := milliseconds(s.game.Config.TradeTimeout)
+	for _, p := range s.trades.Expire(tick, timeout) {
+		p.User.Message(NewTradeExpiredMessage(p.Trade))
+	}
+
+	var waiting []*TradeProposal
+	for _, p := range s.proposals {
+		if tick < p.Deadline {
+			waiting = append(waiting, p)
+			continue
+		}
+		for _, o := range p.Offers {
+			o.User.Message(NewTradeExpiredMessage(o.Trade))
+		}
+	}
+	s.proposals = waiting
+}
+
+// End is called when the state is no longer active. Orders and bump offers
+// don't outlast the trading phase, so any left over are cancelled. It does
+// nothing if they've already been cancelled.
+func (s *TradeController) End() {
+	for _, p := range s.trades.Clear() {
+		p.User.Message(NewTradeExpiredMessage(p.Trade))
+	}
+	for _, p := range s.proposals {
+		for _, o := range p.Offers {
+			o.User.Message(NewTradeExpiredMessage(o.Trade))
+		}
+	}
+	s.proposals = nil
+	for _, t := range s.game.Market.Types() {
+		book := s.game.Market.Books[t]
+		orders := book.Clear()
+		for _, o := range orders {
+			s.releaseEscrow(o)
+			o.Owner.Message(NewOrderCancelledMessage(o))
+		}
+		if len(orders) > 0 {
+			s.game.connection.Broadcast(NewOrderBookMessage(t, book))
+		}
+	}
+}
+
+// releaseEscrow gives back whatever was held for the unfilled part of an
+// order.
+func (s *TradeController) releaseEscrow(o *Order) {
+	if o.Side == BidSide {
+		s.game.Ledger.Credit(o.Owner, o.Price*float64(o.Quantity))
+	} else {
+		s.game.Ledger.Deposit(o.Owner, Materials{o.Type: o.Quantity})
+	}
+}
+
+// placeOrder holds back the money or goods for a new order, so that it can
+// always be settled, then matches it against the book.
+func (s *TradeController) placeOrder(u User, msg PlaceOrderMessage) {
+	o := &Order{
+		Owner:    u,
+		Side:     OrderSide(msg.Side),
+		Type:     CommodityType(msg.Type),
+		Price:    msg.Price,
+		Quantity: msg.Quantity,
+		ClientID: msg.ID,
+	}
+	err := s.game.Market.CheckOrder(o)
+	if err == nil && o.Side == BidSide {
+		err = s.game.Ledger.Debit(u, o.Price*float64(o.Quantity))
+	} else if err == nil {
+		err = s.game.Ledger.Withdraw(u, Materials{o.Type: o.Quantity})
+	}
+	if err != nil {
+		log.Printf("Got invalid PlaceOrderMessage: %v", err)
+		u.Message(NewErrorMessage(msg, err))
+		return
+	}
+
+	// The order has already been checked, so it can't be refused.
+	fills, _ := s.game.Market.PlaceOrder(o)
+	u.Message(NewOrderPlacedMessage(o))
+
+	for _, f := range fills {
+		// The buyer gets the goods, and any difference between their
+		// limit and the price paid. The seller gets the money.
+		s.game.Ledger.Deposit(f.Bid.Owner, Materials{o.Type: f.Quantity})
+		s.game.Ledger.Credit(f.Bid.Owner, (f.Bid.Price-f.Price)*float64(f.Quantity))
+		s.game.Ledger.Credit(f.Ask.Owner, f.Price*float64(f.Quantity))
+		s.game.recordSale(f.Ask.Owner, f.Price*float64(f.Quantity))
+
+		f.Bid.Owner.Message(NewOrderFilledMessage(f.Bid, f.Price, f.Quantity))
+		f.Ask.Owner.Message(NewOrderFilledMessage(f.Ask, f.Price, f.Quantity))
+		s.game.recordTrade(f.Bid.Owner)
+		s.game.recordTrade(f.Ask.Owner)
+	}
+	s.game.connection.Broadcast(NewOrderBookMessage(o.Type, s.game.Market.Books[o.Type]))
+}
+
+// trade pairs a bump offer with a waiting one and makes the exchange, or
+// queues it if there's nobody to pair it with.
+func (s *TradeController) trade(p *PendingTrade) {
+	// A new offer replaces the player's last one, and offers which have
+	// timed out can't be taken up.
+	if old := s.trades.Remove(p.User); old != nil {
+		p.User.Message(NewTradeExpiredMessage(old.Trade))
+	}
+	s.Tick(p.Time)
+
+	other := s.trades.Match(p)
+	if other == nil {
+		s.trades.Add(p)
+		return
+	}
+	if s.game.Config.TradeMode == ConfirmedTrades {
+		s.propose(other, p)
+		return
+	}
+	s.settle(other, p)
+}
+
+// settle exchanges the goods in a pair of offers.
+func (s *TradeController) settle(a, b *PendingTrade) {
+	// Both players were checked when they made their offers, but their
+	// holdings may have changed since.
+	err := s.game.Ledger.Exchange(a.User, b.User, a.Trade.Offer, b.Trade.Offer)
+	if err != nil {
+		log.Printf("Unable to complete trade: %v", err)
+		a.User.Message(NewErrorMessage(a.Trade, err))
+		b.User.Message(NewErrorMessage(b.Trade, err))
+		return
+	}
+	log.Printf("Trade completed: %q gave %+v, %q gave %+v",
+		a.User.Name(), a.Trade.Offer, b.User.Name(), b.Trade.Offer)
+	a.User.Message(NewTradeCompletedMessage(b.Trade.Offer, a.Trade.ID))
+	b.User.Message(NewTradeCompletedMessage(a.Trade.Offer, b.Trade.ID))
+	s.game.recordTrade(a.User)
+	s.game.recordTrade(b.User)
+}
+
+// propose shows each player the other's offer, and waits for them both to
+// accept before settling.
+func (s *TradeController) propose(a, b *PendingTrade) {
+	s.nextProposalID++
+	timeout := milliseconds(s.game.Config.ProposalTime)
+	p := &TradeProposal{
+		ID:       s.nextProposalID,
+		Offers:   [2]*PendingTrade{a, b},
+		Deadline: s.game.GetTime() + timeout,
+	}
+	s.proposals = append(s.proposals, p)
+	a.User.Message(NewTradeProposalMessage(p, a.User, timeout))
+	b.User.Message(NewTradeProposalMessage(p, b.User, timeout))
+}
+
+// proposal returns the proposal with the given ID, if u is one of the
+// players in it.
+func (s *TradeController) proposal(u User, id int64) (*TradeProposal, error) {
+	for _, p := range s.proposals {
+		if p.ID == id && p.Involves(u) {
+			return p, nil
+		}
+	}
+	return nil, NewGameError(InvalidRequestError, "No such trade proposal: %v", id)
+}
+
+// hasProposal returns true if u is in a proposal which is still waiting to
+// be accepted.
+func (s *TradeController) hasProposal(u User) bool {
+	for _, p := range s.proposals {
+		if p.Involves(u) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeProposal stops waiting for a proposal to be accepted.
+func (s *TradeController) removeProposal(p *TradeProposal) {
+	for i, o := range s.proposals {
+		if o == p {
+			s.proposals = append(s.proposals[:i], s.proposals[i+1:]...)
+			return
+		}
+	}
+}
 
 // RecieveMessage is called when a user sends the server a message.
 func (s *TradeController) RecieveMessage(u User, m Message) {
 	switch msg := m.(type) {
+	case LeaveMessage:
+		s.trades.Remove(u)
+		var proposals []*TradeProposal
+		for _, p := range s.proposals {
+			if !p.Involves(u) {
+				proposals = append(proposals, p)
+				continue
+			}
+			_, other := p.Sides(u)
+			other.User.Message(NewTradeDeclinedMessage(p, other.User))
+		}
+		s.proposals = proposals
+		// The player's account is already closed, so there's nobody to
+		// give their escrow back to.
+		for _, t := range s.game.Market.Types() {
+			book := s.game.Market.Books[t]
+			if len(book.Remove(u)) > 0 {
+				s.game.connection.Broadcast(NewOrderBookMessage(t, book))
+			}
+		}
+	case PlaceOrderMessage:
+		s.placeOrder(u, msg)
+	case CancelOrderMessage:
+		o, err := s.game.Market.CancelOrder(u, msg.OrderID)
+		if err != nil {
+			u.Message(NewErrorMessage(msg, err))
+			return
+		}
+		s.releaseEscrow(o)
+		// The reply carries the ID of the cancel message, not the order.
+		o.ClientID = msg.ID
+		u.Message(NewOrderCancelledMessage(o))
+		s.game.connection.Broadcast(NewOrderBookMessage(o.Type, s.game.Market.Books[o.Type]))
 	case TradeMessage:
-		isntSelfTrade := s.stagedUser != u
-		withinTimeInterval := s.game.GetTime()-s.stagingTime < TradeTimeout
-		if isntSelfTrade && s.stagedUser != nil && withinTimeInterval {
-			// Execute the currently proposed trade.
-			s.stagedUser.Message(NewTradeCompletedMessage(msg.Materials))
-			u.Message(NewTradeCompletedMessage(s.stagedMaterials))
-
-			// Reset the staged materials
-			s.stagedUser = nil
-			s.stagingTime = 0
-			s.stagedMaterials = ""
-		} else {
-			s.stagedUser = u
-			s.stagingTime = s.game.GetTime()
-			s.stagedMaterials = msg.Materials
+		// Players can only offer what they actually hold.
+		err := s.game.Market.CheckMaterials(msg.Materials)
+		if err == nil {
+			err = s.game.Ledger.CanGive(u, msg.Offer)
+		}
+		// The same goods can't be offered in two proposals at once.
+		if err == nil && s.hasProposal(u) {
+			err = NewGameError(InvalidRequestError,
+				"Can't trade while waiting for a proposed trade to be accepted")
+		}
+		if err != nil {
+			log.Printf("Got invalid TradeMessage: %v", err)
+			u.Message(NewErrorMessage(msg, err))
+			return
+		}
+
+		s.trade(&PendingTrade{User: u, Trade: msg, Time: s.game.GetTime()})
+	case TradeAcceptMessage:
+		p, err := s.proposal(u, msg.ProposalID)
+		if err != nil {
+			u.Message(NewErrorMessage(msg, err))
+			return
+		}
+		// The trade is only settled once both players have accepted.
+		if p.Accept(u) {
+			s.removeProposal(p)
+			s.settle(p.Offers[0], p.Offers[1])
+		}
+	case TradeDeclineMessage:
+		p, err := s.proposal(u, msg.ProposalID)
+		if err != nil {
+			u.Message(NewErrorMessage(msg, err))
+			return
+		}
+		s.removeProposal(p)
+		for _, o := range p.Offers {
+			o.User.Message(NewTradeDeclinedMessage(p, o.User))
 		}
 	case SellMessage:
-		// First, determine the price that the user would get.
-		price, err := s.game.Market.Sell(CommodityType(msg.Type), msg.Quantity)
+		// The user must actually hold the goods that they're selling.
+		t := CommodityType(msg.Type)
+		if msg.Quantity <= 0 {
+			u.Message(NewErrorMessage(msg, NewGameError(
+				InvalidRequestError, "Invalid quantity of %v: %v", t, msg.Quantity)))
+			return
+		}
+		goods := Materials{t: msg.Quantity}
+		if err := s.game.Ledger.Withdraw(u, goods); err != nil {
+			log.Printf("Got invalid SellMessage: %v", err)
+			u.Message(NewErrorMessage(msg, err))
+			return
+		}
+		// Next, determine the price that the user would get.
+		price, err := s.game.Market.Sell(t, msg.Quantity)
 		if err != nil {
 			log.Printf("Got invalid SellMessage: %v", err)
+			s.game.Ledger.Deposit(u, goods)
+			u.Message(NewErrorMessage(msg, err))
 			return
 		}
+		s.game.Ledger.Credit(u, price*float64(msg.Quantity))
+		s.game.recordSale(u, price*float64(msg.Quantity))
 		// Inform the user that their sale is done.
 		response := NewSaleCompletedMessage(msg, price)
 		u.Message(response)
 		// Update all other users that the price has changed.
 		s.game.connection.Broadcast(NewPriceUpdatedMessage(s.game.Market))
+	case BuyMessage:
+		t := CommodityType(msg.Type)
+		if msg.Quantity <= 0 {
+			u.Message(NewErrorMessage(msg, NewGameError(
+				InvalidRequestError, "Invalid quantity of %v: %v", t, msg.Quantity)))
+			return
+		}
+		// The user must be able to pay for the goods before the market
+		// parts with them.
+		price, err := s.game.Market.BuyPrice(t, msg.Quantity)
+		if err == nil {
+			err = s.game.Ledger.Debit(u, price*float64(msg.Quantity))
+		}
+		if err != nil {
+			log.Printf("Got invalid BuyMessage: %v", err)
+			u.Message(NewErrorMessage(msg, err))
+			return
+		}
+		s.game.Market.Buy(t, msg.Quantity)
+		s.game.Ledger.Deposit(u, Materials{t: msg.Quantity})
+		u.Message(NewPurchaseCompletedMessage(msg, price))
+		s.game.connection.Broadcast(NewPriceUpdatedMessage(s.game.Market))
 	}
 }
 
+// GameOverController is the final state of the game, once the end condition
+// has been met. Nothing more can happen, apart from players coming and going.
+type GameOverController struct {
+	name      GameState
+	game      *Game
+	standings []Standing
+}
+
+// NewGameOverController creates a GameOverController instance.
+func NewGameOverController(game *Game) *GameOverController {
+	return &GameOverController{
+		name: GameOverState,
+		game: game,
+	}
+}
+
+// Name returns the name of the current state.
+func (s *GameOverController) Name() GameState { return s.name }
+
+// Begin is called when the state becomes active. The standings are decided
+// once, when the game ends.
+func (s *GameOverController) Begin() {
+	s.standings = s.game.Standings()
+	s.game.connection.Broadcast(s.message())
+}
+
+// End is called when the state is no longer active.
+func (s *GameOverController) End() {}
+
+// Timer is never set once the game is over.
+func (s *GameOverController) Timer(tick time.Duration) {}
+
+// RecieveMessage is called when a user sends the server a message.
+func (s *GameOverController) RecieveMessage(u User, m Message) {
+	switch m.(type) {
+	case JoinMessage, ResumeMessage:
+		// Latecomers still get to see who won.
+		u.Message(s.message())
+	}
+}
+
+func (s *GameOverController) message() Message {
+	return NewGameOverMessage(s.game.endReason, s.standings)
+}
+
 // NewStateController creates a state controller based on the requested state.
 func NewStateController(game *Game, state GameState) StateController {
 	switch state {
@@ -309,6 +775,8 @@ func NewStateController(game *Game, state GameState) StateController {
 		return NewAuctionController(game)
 	case TradeState:
 		return NewTradeController(game)
+	case GameOverState:
+		return NewGameOverController(game)
 	default:
 		panic("Unknown state!")
 	}
@@ -1,10 +1,15 @@
 package main
 
-import "testing"
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
 
 func TestAuctionBidding(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
+	game := NewGame("g", &connection, DefaultGameConfig())
 	ctrl := NewAuctionController(game)
 
 	u1 := &TestUser{}
@@ -12,29 +17,29 @@ func TestAuctionBidding(t *testing.T) {
 	ctrl.RecieveMessage(u1, NewBidMessage(10))
 	ctrl.RecieveMessage(u2, NewBidMessage(5))
 
-	if ctrl.bid != 10 {
-		t.Errorf("Expected ctrl.bid = 10, got %v", ctrl.bid)
+	if bidOf(ctrl) != 10 {
+		t.Errorf("Expected bidOf(ctrl) = 10, got %v", bidOf(ctrl))
 	}
-	if ctrl.winner != u1 {
-		t.Errorf("Expected ctrl.winner = u, got %v", ctrl.winner)
+	if winnerOf(ctrl) != u1 {
+		t.Errorf("Expected winnerOf(ctrl) = u, got %v", winnerOf(ctrl))
 	}
 
 	// Can't win by bidding the same amount.
 	ctrl.RecieveMessage(u2, NewBidMessage(10))
-	if ctrl.winner != u1 {
-		t.Errorf("Expected ctrl.winner = u, got %v", ctrl.winner)
+	if winnerOf(ctrl) != u1 {
+		t.Errorf("Expected winnerOf(ctrl) = u, got %v", winnerOf(ctrl))
 	}
 
 	// Outbidding will switch winner.
 	ctrl.RecieveMessage(u2, NewBidMessage(12))
-	if ctrl.winner != u2 {
-		t.Errorf("Expected ctrl.winner = u, got %v", ctrl.winner)
+	if winnerOf(ctrl) != u2 {
+		t.Errorf("Expected winnerOf(ctrl) = u, got %v", winnerOf(ctrl))
 	}
 }
 
 func TestProductionTimeout(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
+	game := NewGame("g", &connection, DefaultGameConfig())
 	ctrl := NewProductionController(game)
 	ctrl.Begin()
 
@@ -50,14 +55,59 @@ func TestProductionTimeout(t *testing.T) {
 	want.Broadcast(NewSetClockMessage(AuctionBidTime))
 
 	if len(want.broadcastLog) == 0 || connection.broadcastLog[0] != want.broadcastLog[0] {
-		t.Errorf("Production timeout: got %q, want %q, diff: %v",
+		t.Errorf("Production timeout: got %q, want %q",
 			connection.broadcastLog, want.broadcastLog)
 	}
 }
 
+func TestProductionHarvest(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewProductionController(game)
+	ctrl.Begin()
+	game.state = ctrl
+	game.Yield[Corn] = 2.00
+
+	user := &TestUser{}
+	game.Ledger.Deposit(user, Materials{Tomato: 1})
+	game.Ledger.Account(user).Factories[Corn] = 1
+	ctrl.RecieveMessage(user, NewPlantMessage(Tomato))
+	ctrl.RecieveMessage(user, NewPlantMessage(Corn))
+
+	game.Tick(ProductionTimeout + 1)
+
+	// The new corn factory is built before the harvest, so both yield.
+	account := game.Ledger.Account(user)
+	if account.Factories[Corn] != 2 || account.Factories[Tomato] != 0 {
+		t.Errorf("account.Factories = %v, want 2 corn", account.Factories)
+	}
+
+	harvest := Materials{Corn: 4}
+	if account.Materials[Corn] != 4 || account.Materials[Tomato] != 1 {
+		t.Errorf("account.Materials = %v, want 4 corn and 1 tomato", account.Materials)
+	}
+
+	want := &TestUser{}
+	want.Message(NewInventoryUpdatedMessage(account, harvest))
+	if diff := CompareMessageLog(user, want); diff != "" {
+		t.Errorf("InventoryUpdatedMessage: %q, %q, diff: %v",
+			user.messageLog, want.messageLog, diff)
+	}
+}
+
+func TestHarvestRounding(t *testing.T) {
+	yield := map[CommodityType]float64{Tomato: 1.5}
+	harvest := Harvest(Materials{Tomato: 100}, yield)
+
+	// Each factory yields either 1 or 2.
+	if harvest[Tomato] < 100 || harvest[Tomato] > 200 {
+		t.Errorf("Harvest(...) = %v, want between 100 and 200 tomato", harvest)
+	}
+}
+
 func TestAuctionTimeout(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
+	game := NewGame("g", &connection, DefaultGameConfig())
 	ctrl := NewAuctionController(game)
 	game.state = ctrl
 
@@ -77,11 +127,19 @@ func TestAuctionTimeout(t *testing.T) {
 		t.Errorf("AuctionWonMessage: %q, %q, diff: %v",
 			user.messageLog, want.messageLog, diff)
 	}
+
+	// Only the winner pays for the card.
+	if money := game.Ledger.Account(user).Money; money != StartingMoney-10 {
+		t.Errorf("winner's money = %v, want %v", money, StartingMoney-10)
+	}
+	if money := game.Ledger.Account(loser).Money; money != StartingMoney {
+		t.Errorf("loser's money = %v, want %v", money, StartingMoney)
+	}
 }
 
 func TestSelling(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
+	game := NewGame("g", &connection, DefaultGameConfig())
 	ctrl := NewTradeController(game)
 	game.state = ctrl
 	game.Market.Commodities[Tomato].Value = 100
@@ -89,6 +147,7 @@ func TestSelling(t *testing.T) {
 	game.Market.Commodities[Tomato].Demand = 100
 
 	user := &TestUser{}
+	game.Ledger.Deposit(user, Materials{Tomato: 1})
 	ctrl.RecieveMessage(user, NewSellMessage(Tomato, 1))
 
 	// Expect the winner to get a winning message.
@@ -107,24 +166,120 @@ func TestSelling(t *testing.T) {
 		t.Errorf("SaleCompletedMessage: %q, %q, diff: %v",
 			user.messageLog, want.messageLog, diff)
 	}
+
+	// The proceeds of the sale are credited to the seller.
+	account := game.Ledger.Account(user)
+	if account.Money != StartingMoney+50 {
+		t.Errorf("account.Money = %v, want %v", account.Money, StartingMoney+50)
+	}
+	if account.Materials[Tomato] != 0 {
+		t.Errorf("account.Materials[Tomato] = %v, want 0", account.Materials[Tomato])
+	}
+}
+
+func TestSellingWithoutGoods(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	user := &TestUser{}
+	game.Ledger.Deposit(user, Materials{Tomato: 1})
+	ctrl.RecieveMessage(user, NewSellMessage(Tomato, 2))
+
+	// The sale is refused, and the market is untouched.
+	want := &TestUser{}
+	want.Message(NewErrorMessage(NewSellMessage(Tomato, 2), game.Ledger.Has(user, Materials{Tomato: 2})))
+
+	if diff := CompareMessageLog(user, want); diff != "" {
+		t.Errorf("ErrorMessage: %q, %q, diff: %v",
+			user.messageLog, want.messageLog, diff)
+	}
+	if len(connection.broadcastLog) != 0 {
+		t.Errorf("Unexpected broadcast: %q", connection.broadcastLog)
+	}
+	if account := game.Ledger.Account(user); account.Money != StartingMoney {
+		t.Errorf("account.Money = %v, want %v", account.Money, StartingMoney)
+	}
+}
+
+func TestAuctionMinimumBid(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Deck = NewDeck([]Card{{Name: "Pricey", Cost: 5}}, seeded())
+	ctrl := NewAuctionController(game)
+	ctrl.Begin()
+
+	u := &TestUser{}
+	ctrl.RecieveMessage(u, NewBidMessage(4))
+	if winnerOf(ctrl) != nil {
+		t.Errorf("Expected winnerOf(ctrl) = nil, got %v", winnerOf(ctrl))
+	}
+
+	ctrl.RecieveMessage(u, NewBidMessage(5))
+	if winnerOf(ctrl) != u {
+		t.Errorf("Expected winnerOf(ctrl) = u, got %v", winnerOf(ctrl))
+	}
+}
+
+func TestAuctionWinnerAppliesCard(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	game.Deck = NewDeck([]Card{{
+		Name:              "Boom",
+		YieldRateModifier: map[CommodityType]float64{Corn: 2.00},
+		PriceModifier:     map[CommodityType]float64{Tomato: 0.5},
+	}}, seeded())
+	ctrl := NewAuctionController(game)
+	game.state = ctrl
+	ctrl.Begin()
+
+	user := &TestUser{}
+	ctrl.RecieveMessage(user, NewBidMessage(1))
+	game.Tick(2 * AuctionBidTime)
+
+	if game.Yield[Corn] != 2.00 || game.Yield[Tomato] != 1.00 {
+		t.Errorf("game.Yield = %v, want corn doubled", game.Yield)
+	}
+	if game.Market.Modifier[Tomato] != 0.5 || game.Market.Modifier[Corn] != 1.00 {
+		t.Errorf("game.Market.Modifier = %v, want tomato halved", game.Market.Modifier)
+	}
+}
+
+func TestAuctionBidTooHigh(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewAuctionController(game)
+
+	u := &TestUser{}
+	ctrl.RecieveMessage(u, NewBidMessage(int(StartingMoney)+1))
+
+	if winnerOf(ctrl) != nil {
+		t.Errorf("Expected winnerOf(ctrl) = nil, got %v", winnerOf(ctrl))
+	}
+	if len(u.messageLog) != 1 {
+		t.Errorf("Expected an error message, got %q", u.messageLog)
+	}
 }
 
 func TestTradeMechanism(t *testing.T) {
 	connection := TestConnection{}
-	game := NewGame("g", &connection)
+	game := NewGame("g", &connection, DefaultGameConfig())
 	ctrl := NewTradeController(game)
 	game.state = ctrl
 
 	userA := &TestUser{}
 	userB := &TestUser{}
-	ctrl.RecieveMessage(userA, NewTradeMessage("a gold bar"))
-	ctrl.RecieveMessage(userB, NewTradeMessage("a ham sandwich"))
+	game.Ledger.Deposit(userA, Materials{Tomato: 2})
+	game.Ledger.Deposit(userB, Materials{Corn: 1})
+	ctrl.RecieveMessage(userA, NewTradeMessage(Materials{Tomato: 2}, 0))
+	ctrl.RecieveMessage(userB, NewTradeMessage(Materials{Corn: 1}, 0))
 
 	// Expect the users to exchange messages.
 	wantA := &TestUser{}
-	wantA.Message(NewTradeCompletedMessage("a ham sandwich"))
+	wantA.Message(NewTradeCompletedMessage(Offer{Materials: Materials{Corn: 1}}, ""))
 	wantB := &TestUser{}
-	wantB.Message(NewTradeCompletedMessage("a gold bar"))
+	wantB.Message(NewTradeCompletedMessage(Offer{Materials: Materials{Tomato: 2}}, ""))
 
 	if diff := CompareMessageLog(userA, wantA); diff != "" {
 		t.Errorf("TradeMessage: %q, %q, diff: %v",
@@ -139,12 +294,14 @@ func TestTradeMechanism(t *testing.T) {
 	// Subsequent trade is too slow and fails to complete.
 	userC := &TestUser{}
 	userD := &TestUser{}
-	ctrl.RecieveMessage(userC, NewTradeMessage("nothing"))
+	game.Ledger.Deposit(userD, Materials{Purple: 1})
+	ctrl.RecieveMessage(userC, NewTradeMessage(Materials{}, 0))
 
 	game.Tick(TradeTimeout * 2)
 
-	ctrl.RecieveMessage(userD, NewTradeMessage("something"))
+	ctrl.RecieveMessage(userD, NewTradeMessage(Materials{Purple: 1}, 0))
 	wantC := &TestUser{}
+	wantC.Message(NewTradeExpiredMessage(NewTradeMessage(Materials{}, 0)))
 	wantD := &TestUser{}
 
 	if diff := CompareMessageLog(userC, wantC); diff != "" {
@@ -160,18 +317,20 @@ func TestTradeMechanism(t *testing.T) {
 
 	userE := &TestUser{}
 	userF := &TestUser{}
-	ctrl.RecieveMessage(userE, NewTradeMessage("widget"))
+	game.Ledger.Deposit(userE, Materials{Blueberry: 1})
+	game.Ledger.Deposit(userF, Materials{Tomato: 1})
+	ctrl.RecieveMessage(userE, NewTradeMessage(Materials{Blueberry: 1}, 0))
 
 	// Short delay.
 	game.Tick(TradeTimeout*4 + 5)
 
-	ctrl.RecieveMessage(userF, NewTradeMessage("wodget"))
+	ctrl.RecieveMessage(userF, NewTradeMessage(Materials{Tomato: 1}, 0))
 
 	// Expect the users to exchange messages.
 	wantE := &TestUser{}
-	wantE.Message(NewTradeCompletedMessage("wodget"))
+	wantE.Message(NewTradeCompletedMessage(Offer{Materials: Materials{Tomato: 1}}, ""))
 	wantF := &TestUser{}
-	wantF.Message(NewTradeCompletedMessage("widget"))
+	wantF.Message(NewTradeCompletedMessage(Offer{Materials: Materials{Blueberry: 1}}, ""))
 
 	if diff := CompareMessageLog(userE, wantE); diff != "" {
 		t.Errorf("TradeMessage: %q, %q, diff: %v",
@@ -182,3 +341,530 @@ func TestTradeMechanism(t *testing.T) {
 			userF.messageLog, wantF.messageLog, diff)
 	}
 }
+
+func TestTradeSettlesLedger(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	userA := &TestUser{}
+	userB := &TestUser{}
+	game.Ledger.Deposit(userA, Materials{Tomato: 3})
+	game.Ledger.Deposit(userB, Materials{Corn: 1})
+	ctrl.RecieveMessage(userA, NewTradeMessage(Materials{Tomato: 2}, 0))
+	ctrl.RecieveMessage(userB, NewTradeMessage(Materials{Corn: 1}, 0))
+
+	a := game.Ledger.Account(userA)
+	b := game.Ledger.Account(userB)
+	if a.Materials[Tomato] != 1 || a.Materials[Corn] != 1 {
+		t.Errorf("userA materials = %v, want 1 tomato and 1 corn", a.Materials)
+	}
+	if b.Materials[Tomato] != 2 || b.Materials[Corn] != 0 {
+		t.Errorf("userB materials = %v, want 2 tomato and 0 corn", b.Materials)
+	}
+
+	// Offering goods that you don't hold is refused.
+	userC := &TestUser{}
+	ctrl.RecieveMessage(userC, NewTradeMessage(Materials{Purple: 1}, 0))
+	if n := ctrl.trades.Len(); n != 0 {
+		t.Errorf("ctrl.trades.Len() = %v, want 0", n)
+	}
+	if len(userC.messageLog) != 1 {
+		t.Errorf("Expected an error message, got %q", userC.messageLog)
+	}
+}
+
+func TestTradeEchoesIDs(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	userA := &TestUser{}
+	userB := &TestUser{}
+	game.Ledger.Deposit(userA, Materials{Tomato: 1})
+	game.Ledger.Deposit(userB, Materials{Corn: 1})
+	ctrl.RecieveMessage(userA, TradeMessage{
+		Action: string(TradeAction), Offer: Offer{Materials: Materials{Tomato: 1}}, ID: "a1",
+	})
+	ctrl.RecieveMessage(userB, TradeMessage{
+		Action: string(TradeAction), Offer: Offer{Materials: Materials{Corn: 1}}, ID: "b1",
+	})
+
+	// Each user gets a reply to their own message.
+	wantA := &TestUser{}
+	wantA.Message(NewTradeCompletedMessage(Offer{Materials: Materials{Corn: 1}}, "a1"))
+	wantB := &TestUser{}
+	wantB.Message(NewTradeCompletedMessage(Offer{Materials: Materials{Tomato: 1}}, "b1"))
+
+	if diff := CompareMessageLog(userA, wantA); diff != "" {
+		t.Errorf("TradeCompletedMessage: %v", diff)
+	}
+	if diff := CompareMessageLog(userB, wantB); diff != "" {
+		t.Errorf("TradeCompletedMessage: %v", diff)
+	}
+}
+
+func TestAuctionWinnerLeaves(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewAuctionController(game)
+	game.state = ctrl
+
+	winner := &TestUser{name: "winner"}
+	other := &TestUser{name: "other"}
+	ctrl.RecieveMessage(other, NewBidMessage(5))
+	ctrl.RecieveMessage(winner, NewBidMessage(10))
+	game.RecieveMessage(winner, NewLeaveMessage())
+
+	if winnerOf(ctrl) != nil || bidOf(ctrl) != 0 {
+		t.Errorf("winnerOf(ctrl), bidOf(ctrl) = %v, %v, want nil, 0", winnerOf(ctrl), bidOf(ctrl))
+	}
+
+	// The remaining players can bid again from scratch.
+	ctrl.RecieveMessage(other, NewBidMessage(1))
+	if winnerOf(ctrl) != other {
+		t.Errorf("Expected winnerOf(ctrl) = other, got %v", winnerOf(ctrl))
+	}
+}
+
+func TestWaitingTraderLeaves(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	userA := &TestUser{}
+	userB := &TestUser{}
+	game.Ledger.Deposit(userA, Materials{Tomato: 1})
+	ctrl.RecieveMessage(userA, NewTradeMessage(Materials{Tomato: 1}, 0))
+	game.RecieveMessage(userA, NewLeaveMessage())
+
+	// The departed player's offer is gone, so there's nobody to trade with.
+	ctrl.RecieveMessage(userB, NewTradeMessage(Materials{}, 0))
+	if len(userB.messageLog) != 0 {
+		t.Errorf("Unexpected messages: %q", userB.messageLog)
+	}
+	if n := ctrl.trades.Len(); n != 1 {
+		t.Errorf("ctrl.trades.Len() = %v, want 1", n)
+	}
+}
+
+func TestBuying(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+	game.Market.Commodities[Tomato].Value = 20
+	game.Market.Commodities[Tomato].Supply = 101
+	game.Market.Commodities[Tomato].Demand = 100
+
+	user := &TestUser{}
+	ctrl.RecieveMessage(user, NewBuyMessage(Tomato, 1))
+
+	want := &TestUser{}
+	want.Message(NewPurchaseCompletedMessage(NewBuyMessage(Tomato, 1), 10))
+	if diff := CompareMessageLog(user, want); diff != "" {
+		t.Errorf("PurchaseCompletedMessage: %q, %q, diff: %v",
+			user.messageLog, want.messageLog, diff)
+	}
+
+	expected := TestConnection{}
+	expected.Broadcast(NewPriceUpdatedMessage(game.Market))
+	if diff := CompareBroadcastLog(connection, expected); diff != "" {
+		t.Errorf("PriceUpdatedMessage: %v", diff)
+	}
+
+	// The buyer pays for the goods, which leave the market.
+	account := game.Ledger.Account(user)
+	if account.Money != StartingMoney-10 {
+		t.Errorf("account.Money = %v, want %v", account.Money, StartingMoney-10)
+	}
+	if account.Materials[Tomato] != 1 {
+		t.Errorf("account.Materials[Tomato] = %v, want 1", account.Materials[Tomato])
+	}
+	if supply := game.Market.Commodities[Tomato].Supply; supply != 100 {
+		t.Errorf("Supply of tomatoes = %v, want 100", supply)
+	}
+}
+
+func TestBuyingTooMuch(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+	game.Market.Commodities[Tomato].Supply = 2
+
+	tests := []struct {
+		quantity int64
+		code     ErrorCode
+	}{
+		// The market can't sell more than it holds.
+		{3, InvalidRequestError},
+		// The user can't afford it.
+		{2, InsufficientFundsError},
+		{0, InvalidRequestError},
+	}
+	for _, test := range tests {
+		user := &TestUser{}
+		ctrl.RecieveMessage(user, NewBuyMessage(Tomato, test.quantity))
+		msg, ok := DecodeLastMessage(t, user).(ErrorMessage)
+		if !ok || msg.Code != string(test.code) {
+			t.Errorf("Buying %v tomatoes: got %v, want a %v error",
+				test.quantity, user.messageLog, test.code)
+		}
+		if money := game.Ledger.Account(user).Money; money != StartingMoney {
+			t.Errorf("Buying %v tomatoes: money = %v, want %v",
+				test.quantity, money, StartingMoney)
+		}
+	}
+	if supply := game.Market.Commodities[Tomato].Supply; supply != 2 {
+		t.Errorf("Supply of tomatoes = %v, want 2", supply)
+	}
+}
+
+func TestOrderBookTrading(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	seller := &TestUser{name: "seller"}
+	buyer := &TestUser{name: "buyer"}
+	game.Ledger.Deposit(seller, Materials{Corn: 5})
+
+	// The goods and money are held back as soon as the orders are placed.
+	ctrl.RecieveMessage(seller, NewPlaceOrderMessage(Corn, AskSide, 3, 5))
+	if got := game.Ledger.Account(seller).Materials[Corn]; got != 0 {
+		t.Errorf("Seller holds %v corn after placing an ask, want 0", got)
+	}
+	bid := NewPlaceOrderMessage(Corn, BidSide, 4, 2)
+	bid.ID = "b1"
+	ctrl.RecieveMessage(buyer, bid)
+
+	// The bid fills at the ask's price, and the buyer gets the difference
+	// back.
+	if got := game.Ledger.Account(buyer).Money; got != StartingMoney-6 {
+		t.Errorf("Buyer's money = %v, want %v", got, StartingMoney-6)
+	}
+	if got := game.Ledger.Account(buyer).Materials[Corn]; got != 2 {
+		t.Errorf("Buyer holds %v corn, want 2", got)
+	}
+	if got := game.Ledger.Account(seller).Money; got != StartingMoney+6 {
+		t.Errorf("Seller's money = %v, want %v", got, StartingMoney+6)
+	}
+	filled, ok := DecodeLastMessage(t, buyer).(OrderFilledMessage)
+	if !ok || filled.Price != 3 || filled.Quantity != 2 || filled.ID != "b1" {
+		t.Errorf("Last message to buyer = %v, want the order filled", buyer.messageLog)
+	}
+	book, ok := DecodeLastMessage(t, &TestUser{messageLog: connection.broadcastLog}).(OrderBookMessage)
+	if diff := cmp.Diff([]PriceLevel{{Price: 3, Quantity: 3}}, book.Asks); !ok || diff != "" {
+		t.Errorf("Order book depth differs (-want +got):\n%v", diff)
+	}
+
+	// The seller's proceeds count towards their earnings for the round.
+	if got := game.stats.player(seller).Earnings; got != 6 {
+		t.Errorf("Seller's earnings = %v, want 6", got)
+	}
+
+	// The seller can't buy back their own goods.
+	ctrl.RecieveMessage(seller, NewPlaceOrderMessage(Corn, BidSide, 3, 1))
+	if msg, ok := DecodeLastMessage(t, seller).(ErrorMessage); !ok || msg.Code != string(InvalidRequestError) {
+		t.Errorf("Trading with yourself: got %v, want an error", seller.messageLog)
+	}
+	if got := game.Ledger.Account(seller).Money; got != StartingMoney+6 {
+		t.Errorf("Seller's money = %v after a refused order, want %v", got, StartingMoney+6)
+	}
+
+	// Nobody else can cancel the seller's order.
+	ctrl.RecieveMessage(buyer, NewCancelOrderMessage(1))
+	if msg, ok := DecodeLastMessage(t, buyer).(ErrorMessage); !ok || msg.Code != string(InvalidRequestError) {
+		t.Errorf("Cancelling somebody else's order: got %v, want an error", buyer.messageLog)
+	}
+
+	// The rest of the seller's goods are returned when trading is over.
+	ctrl.End()
+	if got := game.Ledger.Account(seller).Materials[Corn]; got != 3 {
+		t.Errorf("Seller holds %v corn after trading, want 3", got)
+	}
+	if _, ok := DecodeLastMessage(t, seller).(OrderCancelledMessage); !ok {
+		t.Errorf("Last message to seller = %v, want the order cancelled", seller.messageLog)
+	}
+}
+
+func TestOrderEscrow(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	tests := []struct {
+		order PlaceOrderMessage
+		code  ErrorCode
+	}{
+		{NewPlaceOrderMessage(Corn, BidSide, StartingMoney, 2), InsufficientFundsError},
+		{NewPlaceOrderMessage(Corn, AskSide, 1, 1), InsufficientMaterialsError},
+		{NewPlaceOrderMessage(Corn, BidSide, 1, -1), InvalidRequestError},
+		{NewPlaceOrderMessage(Corn, BidSide, -1, 1), InvalidRequestError},
+		{NewPlaceOrderMessage(Corn, "swap", 1, 1), InvalidRequestError},
+		{NewPlaceOrderMessage("spice", BidSide, 1, 1), InvalidRequestError},
+	}
+	for _, test := range tests {
+		user := &TestUser{}
+		ctrl.RecieveMessage(user, test.order)
+		msg, ok := DecodeLastMessage(t, user).(ErrorMessage)
+		if !ok || msg.Code != string(test.code) {
+			t.Errorf("Placing %+v: got %v, want a %v error", test.order, user.messageLog, test.code)
+		}
+		if money := game.Ledger.Account(user).Money; money != StartingMoney {
+			t.Errorf("Placing %+v: money = %v, want %v", test.order, money, StartingMoney)
+		}
+	}
+
+	// Cancelling a bid returns the money.
+	user := &TestUser{}
+	ctrl.RecieveMessage(user, NewPlaceOrderMessage(Corn, BidSide, 2, 5))
+	placed := DecodeLastMessage(t, user).(OrderPlacedMessage)
+	ctrl.RecieveMessage(user, NewCancelOrderMessage(placed.OrderID))
+	if money := game.Ledger.Account(user).Money; money != StartingMoney {
+		t.Errorf("Money after cancelling = %v, want %v", money, StartingMoney)
+	}
+}
+
+func TestTradeWithMoney(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	userA := &TestUser{}
+	userB := &TestUser{}
+	game.Ledger.Deposit(userA, Materials{Tomato: 3})
+	ctrl.RecieveMessage(userA, NewTradeMessage(Materials{Tomato: 3}, 0))
+	ctrl.RecieveMessage(userB, NewTradeMessage(nil, 5))
+
+	wantA := &TestUser{}
+	wantA.Message(NewTradeCompletedMessage(Offer{Money: 5}, ""))
+	if diff := CompareMessageLog(userA, wantA); diff != "" {
+		t.Errorf("TradeCompletedMessage: %v", diff)
+	}
+	if got := game.Ledger.Account(userA).Money; got != StartingMoney+5 {
+		t.Errorf("userA's money = %v, want %v", got, StartingMoney+5)
+	}
+	if got := game.Ledger.Account(userB).Materials[Tomato]; got != 3 {
+		t.Errorf("userB's tomatoes = %v, want 3", got)
+	}
+}
+
+func TestMalformedTrades(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	tests := []struct {
+		trade TradeMessage
+		code  ErrorCode
+	}{
+		{NewTradeMessage(Materials{Tomato: -1}, 0), InvalidRequestError},
+		{NewTradeMessage(nil, -5), InvalidRequestError},
+		{NewTradeMessage(Materials{"gold": 1}, 0), InvalidRequestError},
+		{NewTradeMessage(nil, StartingMoney+1), InsufficientFundsError},
+	}
+	for _, test := range tests {
+		user := &TestUser{}
+		ctrl.RecieveMessage(user, test.trade)
+		msg, ok := DecodeLastMessage(t, user).(ErrorMessage)
+		if !ok || msg.Code != string(test.code) {
+			t.Errorf("Trading %+v: got %v, want a %v error", test.trade.Offer, user.messageLog, test.code)
+		}
+	}
+	if n := ctrl.trades.Len(); n != 0 {
+		t.Errorf("%v malformed trades were queued", n)
+	}
+}
+
+func TestReplacedTradeOffer(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	user := &TestUser{}
+	first := NewTradeMessage(nil, 0)
+	first.ID = "t1"
+	second := NewTradeMessage(nil, 0)
+	second.ID = "t2"
+	ctrl.RecieveMessage(user, first)
+	ctrl.RecieveMessage(user, second)
+
+	// The first offer is answered, even though it was never taken up.
+	want := &TestUser{}
+	want.Message(NewTradeExpiredMessage(first))
+	if diff := CompareMessageLog(user, want); diff != "" {
+		t.Errorf("TradeExpiredMessage: %v", diff)
+	}
+	if n := ctrl.trades.Len(); n != 1 {
+		t.Errorf("ctrl.trades.Len() = %v, want 1", n)
+	}
+}
+
+func TestConcurrentBumps(t *testing.T) {
+	connection := TestConnection{}
+	game := NewGame("g", &connection, DefaultGameConfig())
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	// Two pairs of players bump at about the same time. The hinted pair
+	// find each other even though the others' offers arrive in between.
+	users := []*TestUser{{}, {}, {}, {}}
+	for i, u := range users {
+		game.Ledger.Deposit(u, Materials{Tomato: int64(i + 1)})
+	}
+	offer := func(i int, hint string) TradeMessage {
+		m := NewTradeMessage(Materials{Tomato: int64(i + 1)}, 0)
+		m.Hint = hint
+		return m
+	}
+	ctrl.RecieveMessage(users[0], offer(0, "n1"))
+	game.Tick(10 * time.Millisecond)
+	ctrl.RecieveMessage(users[1], offer(1, ""))
+	ctrl.RecieveMessage(users[2], offer(2, ""))
+	game.Tick(20 * time.Millisecond)
+	ctrl.RecieveMessage(users[3], offer(3, "n1"))
+
+	pairs := [][2]int{{0, 3}, {1, 2}}
+	for _, p := range pairs {
+		for _, i := range p {
+			other := p[0] + p[1] - i
+			want := &TestUser{}
+			want.Message(NewTradeCompletedMessage(offer(other, "").Offer, ""))
+			if diff := CompareMessageLog(users[i], want); diff != "" {
+				t.Errorf("user %v: %v", i, diff)
+			}
+		}
+	}
+
+	// Offers that are never paired expire, and so do any left at the end of
+	// the phase.
+	lonely := &TestUser{}
+	late := &TestUser{}
+	ctrl.RecieveMessage(lonely, NewTradeMessage(nil, 0))
+	game.Tick(20*time.Millisecond + TradeTimeout)
+	ctrl.RecieveMessage(late, NewTradeMessage(nil, 0))
+	ctrl.End()
+	for _, u := range []*TestUser{lonely, late} {
+		want := &TestUser{}
+		want.Message(NewTradeExpiredMessage(NewTradeMessage(nil, 0)))
+		if diff := CompareMessageLog(u, want); diff != "" {
+			t.Errorf("TradeExpiredMessage: %v", diff)
+		}
+	}
+}
+
+func TestConfirmedTrades(t *testing.T) {
+	config := DefaultGameConfig()
+	config.TradeMode = ConfirmedTrades
+	connection := TestConnection{}
+	game := NewGame("g", &connection, config)
+	ctrl := NewTradeController(game)
+	game.state = ctrl
+
+	userA := &TestUser{name: "a"}
+	userB := &TestUser{name: "b"}
+	game.Ledger.Deposit(userA, Materials{Tomato: 2})
+	game.Ledger.Deposit(userB, Materials{Corn: 1})
+	offerA := NewTradeMessage(Materials{Tomato: 2}, 0)
+	offerB := NewTradeMessage(Materials{Corn: 1}, 0)
+	bump := func() *TradeProposal {
+		ctrl.RecieveMessage(userA, offerA)
+		ctrl.RecieveMessage(userB, offerB)
+		return ctrl.proposals[len(ctrl.proposals)-1]
+	}
+
+	// Each player is shown the other's offer, and nothing changes hands.
+	p := bump()
+	wantA := &TestUser{}
+	wantA.Message(NewTradeProposalMessage(p, userA, ProposalTime))
+	if diff := CompareMessageLog(userA, wantA); diff != "" {
+		t.Errorf("TradeProposalMessage: %v", diff)
+	}
+	proposal := DecodeLastMessage(t, userB).(TradeProposalMessage)
+	if proposal.Partner != "a" || proposal.Materials[Tomato] != 2 {
+		t.Errorf("userB was shown %+v, want a's 2 tomatoes", proposal)
+	}
+	if got := game.Ledger.Account(userA).Materials[Tomato]; got != 2 {
+		t.Errorf("userA's tomatoes = %v before accepting, want 2", got)
+	}
+
+	// Nothing happens until both have accepted.
+	ctrl.RecieveMessage(userA, NewTradeAcceptMessage(p.ID))
+	if len(userB.messageLog) != 1 {
+		t.Errorf("Unexpected messages: %q", userB.messageLog)
+	}
+	ctrl.RecieveMessage(userB, NewTradeAcceptMessage(p.ID))
+	wantA.Message(NewTradeCompletedMessage(offerB.Offer, ""))
+	if diff := CompareMessageLog(userA, wantA); diff != "" {
+		t.Errorf("TradeCompletedMessage: %v", diff)
+	}
+	if got := game.Ledger.Account(userB).Materials[Tomato]; got != 2 {
+		t.Errorf("userB's tomatoes = %v, want 2", got)
+	}
+
+	// The proposal is gone once it's settled.
+	ctrl.RecieveMessage(userB, NewTradeAcceptMessage(p.ID))
+	if msg, ok := DecodeLastMessage(t, userB).(ErrorMessage); !ok || msg.Code != string(InvalidRequestError) {
+		t.Errorf("Accepting twice: got %v, want an error", userB.messageLog)
+	}
+
+	// Either player can decline.
+	offerA, offerB = offerB, offerA
+	p = bump()
+	ctrl.RecieveMessage(userA, NewTradeAcceptMessage(p.ID))
+	ctrl.RecieveMessage(userB, NewTradeDeclineMessage(p.ID))
+	for _, u := range []*TestUser{userA, userB} {
+		if _, ok := DecodeLastMessage(t, u).(TradeDeclinedMessage); !ok {
+			t.Errorf("Last message = %v, want trade_declined", u.messageLog[len(u.messageLog)-1])
+		}
+	}
+	if got := game.Ledger.Account(userA).Materials[Corn]; got != 1 {
+		t.Errorf("userA's corn = %v after declining, want 1", got)
+	}
+
+	// The same goods can't be put into a second proposal.
+	p = bump()
+	ctrl.RecieveMessage(&TestUser{}, NewTradeMessage(nil, 0))
+	ctrl.RecieveMessage(userA, offerA)
+	if msg, ok := DecodeLastMessage(t, userA).(ErrorMessage); !ok || msg.Code != string(InvalidRequestError) {
+		t.Errorf("Bumping during a proposal: got %v, want an error", userA.messageLog)
+	}
+	if len(ctrl.proposals) != 1 {
+		t.Errorf("%v proposals open, want 1", len(ctrl.proposals))
+	}
+
+	// Proposals which aren't accepted in time expire.
+	game.Tick(ProposalTime)
+	for _, u := range []*TestUser{userA, userB} {
+		if _, ok := DecodeLastMessage(t, u).(TradeExpiredMessage); !ok {
+			t.Errorf("Last message = %v, want trade_expired", u.messageLog[len(u.messageLog)-1])
+		}
+	}
+	if len(ctrl.proposals) != 0 {
+		t.Errorf("%v proposals left after the deadline", len(ctrl.proposals))
+	}
+}
+
+// winnerOf returns the player who would win the card being auctioned, if
+// the auction closed now.
+func winnerOf(ctrl *AuctionController) User {
+	winner, _, _ := ctrl.format.Result()
+	return winner
+}
+
+// bidOf returns the price that the winner of the card being auctioned would
+// pay, if the auction closed now.
+func bidOf(ctrl *AuctionController) int {
+	_, price, _ := ctrl.format.Result()
+	return price
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"time"
+)
+
+// A PendingTrade is a bump offer which hasn't been paired with another yet.
+// Time is the game time at which it was made.
+type PendingTrade struct {
+	User  User
+	Trade TradeMessage
+	Time  time.Duration
+}
+
+// A TradeQueue holds the bump offers waiting to be paired, in the order they
+// were made. Each player has at most one offer in the queue.
+//
+// Offers are paired with the other offer nearest to them in time, which is
+// the most likely to have come from the same bump. Offers carrying a hint,
+// such as a nonce agreed during a proximity handshake, are only paired with
+// offers carrying the same hint, and offers without one only with each
+// other.
+type TradeQueue struct {
+	pending []*PendingTrade
+}
+
+// Match removes and returns the queued offer which best pairs with p, or nil
+// if there isn't one. Ties go to the offer that was made first.
+func (q *TradeQueue) Match(p *PendingTrade) *PendingTrade {
+	best := -1
+	for i, o := range q.pending {
+		if o.User == p.User || o.Trade.Hint != p.Trade.Hint {
+			continue
+		}
+		if best < 0 || distance(o.Time, p.Time) < distance(q.pending[best].Time, p.Time) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return nil
+	}
+	match := q.pending[best]
+	q.pending = append(q.pending[:best], q.pending[best+1:]...)
+	return match
+}
+
+// Add queues an offer, replacing any that the same player already has
+// waiting.
+func (q *TradeQueue) Add(p *PendingTrade) {
+	q.Remove(p.User)
+	q.pending = append(q.pending, p)
+}
+
+// Remove takes a player's offer out of the queue, and returns it, or nil if
+// they didn't have one.
+func (q *TradeQueue) Remove(u User) *PendingTrade {
+	for i, o := range q.pending {
+		if o.User == u {
+			q.pending = append(q.pending[:i], q.pending[i+1:]...)
+			return o
+		}
+	}
+	return nil
+}
+
+// Expire removes and returns the offers which have been waiting for at least
+// timeout at time now.
+func (q *TradeQueue) Expire(now, timeout time.Duration) []*PendingTrade {
+	var expired, waiting []*PendingTrade
+	for _, o := range q.pending {
+		if now-o.Time >= timeout {
+			expired = append(expired, o)
+		} else {
+			waiting = append(waiting, o)
+		}
+	}
+	q.pending = waiting
+	return expired
+}
+
+// Clear empties the queue, and returns the offers that were in it.
+func (q *TradeQueue) Clear() []*PendingTrade {
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+// Len returns the number of offers waiting.
+func (q *TradeQueue) Len() int { return len(q.pending) }
+
+// A TradeProposal is a pair of offers which won't be settled until both
+// players have accepted it, when trades must be confirmed. It's called off
+// if they haven't by the Deadline.
+type TradeProposal struct {
+	ID       int64
+	Offers   [2]*PendingTrade
+	Accepted [2]bool
+	Deadline time.Duration
+}
+
+// Involves returns true if u is one of the players in the proposal.
+func (p *TradeProposal) Involves(u User) bool {
+	return p.Offers[0].User == u || p.Offers[1].User == u
+}
+
+// Sides returns u's own offer and their partner's.
+func (p *TradeProposal) Sides(u User) (own, other *PendingTrade) {
+	if p.Offers[1].User == u {
+		return p.Offers[1], p.Offers[0]
+	}
+	return p.Offers[0], p.Offers[1]
+}
+
+// Accept records that u has accepted the proposal, and returns true once
+// both players have.
+func (p *TradeProposal) Accept(u User) bool {
+	for i, o := range p.Offers {
+		if o.User == u {
+			p.Accepted[i] = true
+		}
+	}
+	return p.Accepted[0] && p.Accepted[1]
+}
+
+// distance returns how far apart two times are.
+func distance(a, b time.Duration) time.Duration {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
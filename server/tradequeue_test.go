@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTradeQueueMatchesNearestInTime(t *testing.T) {
+	a := &PendingTrade{User: &TestUser{}, Time: 10 * time.Millisecond}
+	b := &PendingTrade{User: &TestUser{}, Time: 40 * time.Millisecond}
+	c := &PendingTrade{User: &TestUser{}, Time: 40 * time.Millisecond}
+	q := TradeQueue{}
+	q.Add(a)
+	q.Add(b)
+	q.Add(c)
+
+	// b and c are equally near, so the one made first wins.
+	d := &PendingTrade{User: &TestUser{}, Time: 50 * time.Millisecond}
+	if got := q.Match(d); got != b {
+		t.Errorf("q.Match(d) = %+v, want b", got)
+	}
+	if got := q.Match(d); got != c {
+		t.Errorf("q.Match(d) = %+v, want c", got)
+	}
+	if got := q.Match(d); got != a {
+		t.Errorf("q.Match(d) = %+v, want a", got)
+	}
+	if got := q.Match(d); got != nil {
+		t.Errorf("q.Match(d) = %+v, want nil", got)
+	}
+}
+
+func TestTradeQueueHints(t *testing.T) {
+	hinted := func(u User, hint string) *PendingTrade {
+		return &PendingTrade{User: u, Trade: TradeMessage{Hint: hint}}
+	}
+	a := hinted(&TestUser{}, "x")
+	b := hinted(&TestUser{}, "")
+	q := TradeQueue{}
+	q.Add(a)
+	q.Add(b)
+
+	if got := q.Match(hinted(&TestUser{}, "y")); got != nil {
+		t.Errorf("Matched a different hint: %+v", got)
+	}
+	if got := q.Match(hinted(&TestUser{}, "x")); got != a {
+		t.Errorf("q.Match(...) = %+v, want a", got)
+	}
+	if got := q.Match(hinted(&TestUser{}, "")); got != b {
+		t.Errorf("q.Match(...) = %+v, want b", got)
+	}
+}
+
+func TestTradeQueueOneOfferPerPlayer(t *testing.T) {
+	u := &TestUser{}
+	q := TradeQueue{}
+	q.Add(&PendingTrade{User: u})
+	second := &PendingTrade{User: u, Time: time.Millisecond}
+	q.Add(second)
+
+	if n := q.Len(); n != 1 {
+		t.Errorf("q.Len() = %v, want 1", n)
+	}
+	// Players can't trade with themselves.
+	if got := q.Match(&PendingTrade{User: u}); got != nil {
+		t.Errorf("q.Match(...) = %+v, want nil", got)
+	}
+	if got := q.Remove(u); got != second {
+		t.Errorf("q.Remove(u) = %+v, want the second offer", got)
+	}
+}
+
+func TestTradeQueueExpire(t *testing.T) {
+	old := &PendingTrade{User: &TestUser{}, Time: 0}
+	recent := &PendingTrade{User: &TestUser{}, Time: 50 * time.Millisecond}
+	q := TradeQueue{}
+	q.Add(old)
+	q.Add(recent)
+
+	expired := q.Expire(100*time.Millisecond, 100*time.Millisecond)
+	if len(expired) != 1 || expired[0] != old {
+		t.Errorf("q.Expire(...) = %+v, want the old offer", expired)
+	}
+	if n := q.Len(); n != 1 {
+		t.Errorf("q.Len() = %v, want 1", n)
+	}
+}